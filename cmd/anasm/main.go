@@ -13,6 +13,7 @@ import (
 	"github.com/avm-collection/anasm/internal/token"
 	"github.com/avm-collection/anasm/internal/compiler"
 	"github.com/avm-collection/anasm/internal/disasm"
+	"github.com/avm-collection/anasm/internal/symbols"
 )
 
 var (
@@ -20,12 +21,50 @@ var (
 	v    = flag.Bool("version",    false,   "Show the version")
 	e    = flag.Bool("executable", true,    "Make the output file executable")
 	d    = flag.Bool("disasm",     false,   "Run the disassembler")
+	sym  = flag.Bool("sym",        false,   "Write a symbol map of the output binary into OUT.sym")
+	lay  = flag.Bool("layout",     false,   "Print the memory layout")
+	pool = flag.Bool("pool",       true,    "Share memory between identical read-only data")
 	noW  = flag.Bool("noW",        false,   "Dont show warnings")
+	inc  = flag.Bool("unusedInc",  false,   "Warn about unused symbols in included files too")
+	opt  = flag.Int("O",           0,       "Optimisation level from 0 to 2")
 	maxE = flag.Int("maxE",        8,       "Max compiler errors count")
 
+	defs definitions
+
 	args []string
 )
 
+// Repeatable -D flags
+type definitions []string
+
+func (d *definitions) String() string {
+	return strings.Join(*d, " ")
+}
+
+func (d *definitions) Set(def string) error {
+	*d = append(*d, def)
+	return nil
+}
+
+// -O0, -O1 and -O2 set the optimisation level without a separate value
+type optAlias int
+
+func (o optAlias) String() string {
+	return ""
+}
+
+func (o optAlias) IsBoolFlag() bool {
+	return true
+}
+
+func (o optAlias) Set(value string) error {
+	if value == "true" {
+		*opt = int(o)
+	}
+
+	return nil
+}
+
 func printError(format string, args... interface{}) {
 	fmt.Fprintf(os.Stderr, "Error: %v\n", fmt.Sprintf(format, args...))
 }
@@ -51,11 +90,15 @@ func init() {
 	token.AllTokensCoveredTest()
 
 	flag.Usage = usage
+	flag.Var(&defs, "D", "Define a macro NAME=VALUE, overriding macros with the same name")
 
 	// Aliases
 	flag.BoolVar(v, "v", *v, "Alias for -version")
 	flag.BoolVar(e, "e", *e, "Alias for -executable")
 	flag.BoolVar(d, "d", *d, "Alias for -disasm")
+	flag.Var(optAlias(compiler.OptNone),     "O0", "Alias for -O 0")
+	flag.Var(optAlias(compiler.OptPeephole), "O1", "Alias for -O 1")
+	flag.Var(optAlias(compiler.OptControl),  "O2", "Alias for -O 2")
 
 	flag.Parse()
 
@@ -88,10 +131,30 @@ func assemble(input, path string) {
 	}
 
 	c := compiler.New(input, path)
+	c.UsePooling(*pool)
+	c.WarnUnusedIncluded(*inc)
+	c.Optimise(*opt)
+	for _, def := range defs {
+		if err := c.Define(def); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	if ok := c.Compile(); ok {
 		if err := c.CreateExec(*out, *e); err != nil {
 			printError(err.Error())
 		}
+
+		if *sym {
+			if err := c.Symbols().Write(*out + ".sym"); err != nil {
+				printError(err.Error())
+			}
+		}
+
+		if *lay {
+			c.WriteLayout(os.Stdout)
+		}
 	}
 }
 
@@ -107,6 +170,14 @@ func disassemble(input []byte, path string) {
 	}
 
 	d := disasm.New(input, path)
+
+	// Use the symbol map if there is one
+	if syms, err := symbols.Read(path + ".sym"); err == nil {
+		d.UseSymbols(syms)
+	} else if !os.IsNotExist(err) {
+		printError(err.Error())
+	}
+
 	d.Disassemble(*out)
 }
 
@@ -129,7 +200,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	goerror.NoWarnings(!*noW)
+	if *opt < compiler.OptNone || *opt > compiler.OptControl {
+		printError("Unknown optimisation level '%v'", *opt)
+		printTry("-h")
+
+		os.Exit(1)
+	}
+
+	goerror.NoWarnings(*noW)
 
 	path      := args[0]
 	data, err := os.ReadFile(path)
@@ -0,0 +1,247 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// A value on the simulated stack, only addresses of variables and labels are tracked
+type stackValue struct {
+	Const string
+	Label string
+	Where token.Where
+
+	// Variable the address is inside of or near, with its memory
+	Var         string
+	Addr        agen.Word
+	Start, Size agen.Word
+}
+
+type stack struct {
+	values []stackValue
+}
+
+// Values below the start of the simulation are unknown, make sure there are at least n values
+func (s *stack) reach(n int) {
+	if missing := n - len(s.values); missing > 0 {
+		s.values = append(make([]stackValue, missing), s.values...)
+	}
+}
+
+// Index from the top of the stack, 0 is the top. Values at negative indexes or deeper than the
+// stack are unknown.
+func (s *stack) at(i int) *stackValue {
+	if i < 0 || i >= StackSize {
+		return &stackValue{}
+	}
+
+	s.reach(i + 1)
+	return &s.values[len(s.values) - 1 - i]
+}
+
+// Swaps the top with the value at the index, the stack is grown first so that both of them are
+// in the same slice
+func (s *stack) swap(i int) {
+	if i < 0 || i >= StackSize {
+		*s.at(0) = stackValue{}
+		return
+	}
+
+	s.reach(i + 1)
+	top := len(s.values) - 1
+	s.values[top], s.values[top - i] = s.values[top - i], s.values[top]
+}
+
+func (s *stack) push(v stackValue) {
+	s.values = append(s.values, v)
+}
+
+func (s *stack) pop(n int) {
+	s.reach(n)
+	s.values = s.values[:len(s.values) - n]
+}
+
+func (s *stack) reset() {
+	s.values = nil
+}
+
+// Follows addresses pushed onto the stack through straight-line code and warns when the address
+// of a constant ends up as the destination of a memory write, the address of a label is used as
+// a memory address, or a read or write of a variable does not fit into it. Labels, calls and
+// jumps end the straight-line code, since the stack can be anything there.
+func (c *Compiler) checkMemoryAccess() {
+	var (
+		s stack
+		i int
+	)
+	for _, statement := range c.program.List {
+		switch statement.(type) {
+		case *node.Label: s.reset()
+		case *node.Inst:
+			c.simulateMemoryAccess(&s, c.insts[i])
+			i ++
+		}
+	}
+}
+
+func (c *Compiler) simulateMemoryAccess(s *stack, compiled compiledInst) {
+	n    := compiled.Node
+	inst := Insts[n.Name]
+	switch n.Name {
+	case "psh":
+		v := stackValue{Where: n.Arg.GetToken().Where, Addr: compiled.Arg}
+		v.Const, _ = c.constTarget(n.Arg)
+		v.Label, _ = c.labelTarget(n.Arg)
+		if name, var_, ok := c.varTarget(n.Arg); ok {
+			v.Var, v.Start, v.Size = name, var_.Addr, var_.Size
+		}
+
+		s.push(v)
+
+	case "dup": s.push(*s.at(int(compiled.Arg)))
+	case "swp": s.swap(int(compiled.Arg) + 1)
+
+	case "r08", "r16", "r32", "r64":
+		c.checkAddress(s.at(0), n)
+		c.checkBounds(s.at(0), n)
+
+	case "w08", "w16", "w32", "w64":
+		c.checkConstWrite(s.at(1), n)
+		c.checkAddress(s.at(1), n)
+		c.checkBounds(s.at(1), n)
+
+	case "set":
+		c.checkConstWrite(s.at(2), n)
+		c.checkAddress(s.at(2), n)
+
+	case "cpy":
+		c.checkConstWrite(s.at(2), n)
+		c.checkAddress(s.at(2), n)
+		c.checkAddress(s.at(1), n)
+
+	case "wrf", "rdf": c.checkAddress(s.at(2), n)
+
+	case "jmp", "cal", "ret", "hlt":
+		s.reset()
+		return
+	}
+
+	if n.Name == "psh" || n.Name == "dup" {
+		return
+	} else if inst.Pops == Unknown {
+		s.reset()
+		return
+	}
+
+	s.pop(inst.Pops)
+	for i := 0; i < inst.Pushes; i ++ {
+		s.push(stackValue{})
+	}
+}
+
+func (c *Compiler) checkConstWrite(dest *stackValue, n *node.Inst) {
+	if dest.Const == "" {
+		return
+	}
+
+	goerror.Warning(n.Token.Where, "Write into constant '%v' with '%v'", dest.Const, n.Name)
+	goerror.Note(dest.Where, "Address of '%v' pushed here", dest.Const)
+}
+
+func (c *Compiler) checkAddress(addr *stackValue, n *node.Inst) {
+	if addr.Label == "" {
+		return
+	}
+
+	goerror.Warning(n.Token.Where, "'%v' uses the address of label '%v' as a memory address",
+	                n.Name, addr.Label)
+	goerror.Note(addr.Where, "Address of '%v' pushed here", addr.Label)
+}
+
+// Sizes of the values read and written by memory instructions
+var accessSizes = map[string]agen.Word{
+	"r08": 1, "r16": 2, "r32": 4, "r64": 8,
+	"w08": 1, "w16": 2, "w32": 4, "w64": 8,
+}
+
+func (c *Compiler) checkBounds(addr *stackValue, n *node.Inst) {
+	size := accessSizes[n.Name]
+	if addr.Var == "" || (addr.Addr >= addr.Start && addr.Addr + size <= addr.Start + addr.Size) {
+		return
+	}
+
+	goerror.Warning(n.Token.Where, "'%v' at offset %v goes outside of '%v' with %v bytes",
+	                n.Name, int64(addr.Addr - addr.Start), addr.Var, addr.Size)
+	goerror.Note(addr.Where, "Address of '%v' pushed here", addr.Var)
+}
+
+// Expressions which directly give an address inside of a constant
+func (c *Compiler) constTarget(e node.Expr) (string, bool) {
+	if name, var_, ok := c.varTarget(e); ok && var_.Const {
+		return name, true
+	}
+
+	return "", false
+}
+
+// Expressions which directly give an address inside of a variable or a literal
+func (c *Compiler) varTarget(e node.Expr) (string, Var, bool) {
+	switch n := e.(type) {
+	case *node.Id:
+		if var_, ok := c.vars[n.Value]; ok {
+			return n.Value, var_, true
+		} else if macro, ok := c.macros[n.Value]; ok {
+			return c.varTarget(macro.Expr)
+		}
+
+	case *node.String, *node.Array:
+		if lit, ok := c.literals[n]; ok {
+			return literalName(n), lit, true
+		}
+
+	case *node.At:    return c.varTarget(n.Id)
+	case *node.Field: return c.varTarget(n.Id)
+	case *node.BinOp:
+		switch n.Op {
+		case "+":
+			for _, arg := range n.Args {
+				if name, var_, ok := c.varTarget(arg); ok {
+					return name, var_, true
+				}
+			}
+
+		case "-": return c.varTarget(n.Args[0])
+		}
+	}
+
+	return "", Var{}, false
+}
+
+// Expressions which give the address of a label or an offset from it
+func (c *Compiler) labelTarget(e node.Expr) (string, bool) {
+	switch n := e.(type) {
+	case *node.Id:
+		if _, ok := c.labels[n.Value]; ok {
+			return n.Value, true
+		} else if macro, ok := c.macros[n.Value]; ok {
+			return c.labelTarget(macro.Expr)
+		}
+
+	case *node.BinOp:
+		switch n.Op {
+		case "+":
+			for _, arg := range n.Args {
+				if name, ok := c.labelTarget(arg); ok {
+					return name, true
+				}
+			}
+
+		case "-": return c.labelTarget(n.Args[0])
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,31 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Assertions and user reports are checked once all of the data is placed, in the source order
+func (c *Compiler) checkAsserts() {
+	for _, s := range c.program.List {
+		switch n := s.(type) {
+		case *node.Assert:
+			if c.evalExpr(n.Cond) == 0 {
+				goerror.Error(n.Token.Where, "Assertion failed: %v", n.Message.Value)
+			}
+
+		case *node.Report:
+			if n.Cond != nil && c.evalExpr(n.Cond) == 0 {
+				break
+			}
+
+			if n.Token.Type == token.UserError {
+				goerror.Error(n.Token.Where, "%v", n.Message.Value)
+			} else {
+				goerror.Warning(n.Token.Where, "%v", n.Message.Value)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package compiler
 import (
 	"os"
 	"math"
+	"sort"
 
 	"github.com/avm-collection/goerror"
 	"github.com/avm-collection/agen"
@@ -10,6 +11,7 @@ import (
 	"github.com/avm-collection/anasm/internal/token"
 	"github.com/avm-collection/anasm/internal/parser"
 	"github.com/avm-collection/anasm/internal/node"
+	"github.com/avm-collection/anasm/internal/symbols"
 )
 
 const EntryLabel = "entry"
@@ -17,26 +19,77 @@ const EntryLabel = "entry"
 type Label struct {
 	Token token.Token
 	Addr  agen.Word
+	Size  agen.Word // Instructions until the next label
+
+	Generated bool
 }
 
 type Var struct {
 	Token token.Token
+	Type  *node.Type
+	Count agen.Word
 	Size  agen.Word
 	Addr  agen.Word
+
+	Reserved bool
+	Placed   bool   // Has an address, variables are placed in the source order
+	Fixed    bool   // Placed at an address given with 'org'
+	Const    bool   // Read-only
+	Alias    string // Shares the memory of another read-only variable
 }
 
 type Macro struct {
 	Token token.Token
 	Value agen.Word
+	Float bool
+	Expr  node.Expr // What the value was evaluated from, to follow addresses through macros
 }
 
 type Compiler struct {
 	a       *agen.AGEN
 	program *node.Statements
 
-	labels map[string]Label
-	vars   map[string]Var
-	macros map[string]Macro
+	labels  map[string]Label
+	vars    map[string]Var
+	macros  map[string]Macro
+	structs map[string]Struct
+	enums   map[string]Enum
+
+	decls     map[string]*decl
+	resolving []*decl
+	unreached *decl // Definition resolved before the placement of data reaches it
+	structIds []string
+	inits     []pendingInit
+	defines   []*node.Macro
+
+	memory   []byte
+	cursor   agen.Word // Where the next variable is placed, unless it has a fixed address
+	fixed    []Var
+	reserved []*node.Reserve
+
+	literals  map[node.Expr]Var
+	anonymous []node.Expr // Literals with their own memory
+	pool      []blob
+	pooling   bool
+
+	here   agen.Word // Address of the instruction being compiled
+	size   agen.Word // Instructions in the program
+	inInst bool
+	insts  []compiledInst
+
+	generated int           // Count of lowered control flow statements
+	loopEnds  []*node.Label // End labels of the loops being lowered
+	tables    map[string]*node.Table
+	procs     []proc
+	summaries map[agen.Word]*summary
+
+	used      map[string]bool // Symbols referenced by expressions
+	unusedInc bool
+
+	optLevel  int
+	folds     map[*node.Inst]folded
+	tailCalls map[*node.Inst]bool // Calls before a 'ret' turned into jumps
+	discarded []node.Expr         // Operands of instructions removed by the optimiser
 
 	input, path string
 }
@@ -44,9 +97,25 @@ type Compiler struct {
 func New(input, path string) *Compiler {
 	return &Compiler{
 		a: agen.New(), input: input, path: path,
-		labels: make(map[string]Label),
-		vars:   make(map[string]Var),
-		macros: make(map[string]Macro),
+
+		// Memory always starts with a 0 byte
+		memory: []byte{0},
+		cursor: 1,
+
+		labels:  make(map[string]Label),
+		vars:    make(map[string]Var),
+		macros:  make(map[string]Macro),
+		structs: make(map[string]Struct),
+		enums:   make(map[string]Enum),
+		decls:   make(map[string]*decl),
+		tables:  make(map[string]*node.Table),
+
+		summaries: make(map[agen.Word]*summary),
+		used:      make(map[string]bool),
+		folds:     make(map[*node.Inst]folded),
+		tailCalls: make(map[*node.Inst]bool),
+
+		literals: make(map[node.Expr]Var),
 	}
 }
 
@@ -64,6 +133,14 @@ func (c *Compiler) Compile() bool {
 		return false
 	}
 
+	c.checkMemoryAccess()
+	c.checkJumps()
+	c.checkReachability()
+	c.checkUnused()
+	if c.checkFlow(); goerror.Happened() {
+		return false
+	}
+
 	if _, ok := c.labels[EntryLabel]; !ok {
 		goerror.SimpleError("Program entry point label '%v' not found", EntryLabel)
 		return false
@@ -76,8 +153,65 @@ func (c *Compiler) CreateExec(path string, executable bool) error {
 	return c.a.CreateExecAVM(path, executable)
 }
 
+func (c *Compiler) Symbols() *symbols.Map {
+	m := &symbols.Map{}
+	for name, label := range c.labels {
+		if label.Generated {
+			continue
+		}
+
+		m.Add(symbols.Symbol{Kind: symbols.Label, Name: name, Value: label.Addr})
+	}
+
+	for name, var_ := range c.vars {
+		m.Add(symbols.Symbol{
+			Kind:  symbols.Var,
+			Name:  name,
+			Value: var_.Addr,
+			Size:  var_.Size,
+			Type:  var_.Type.String(),
+
+			ReadOnly: var_.Const,
+			Alias:    var_.Alias,
+		})
+	}
+
+	for name, e := range c.enums {
+		for _, member := range e.Members {
+			m.Add(symbols.Symbol{
+				Kind:   symbols.Enum,
+				Name:   name,
+				Member: member,
+				Value:  c.macros[member].Value,
+			})
+		}
+	}
+
+	sort.SliceStable(m.List, func(i, j int) bool {
+		a, b := m.List[i], m.List[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		} else if a.Kind == symbols.Enum && a.Name != b.Name {
+			return a.Name < b.Name
+		} else if a.Kind != symbols.Enum && a.Value != b.Value {
+			return a.Value < b.Value
+		}
+
+		return a.Kind != symbols.Enum && a.Name < b.Name
+	})
+
+	return m
+}
+
 func (c *Compiler) preproc() {
-	var addr agen.Word
+	c.program.List = c.lower(c.program.List)
+	c.program.List = c.lowerSwitches(c.program.List)
+	c.program.List = c.optimise(c.program.List)
+
+	var (
+		addr  agen.Word
+		order []string
+	)
 	for _, s := range c.program.List {
 		switch n := s.(type) {
 		case *node.Label:
@@ -85,7 +219,12 @@ func (c *Compiler) preproc() {
 				break
 			}
 
-			c.labels[n.Name.Value] = Label{Token: n.Token, Addr: addr}
+			c.labels[n.Name.Value] = Label{Token: n.Token, Addr: addr, Generated: n.Generated}
+			if n.Generated {
+				break
+			}
+
+			order = append(order, n.Name.Value)
 			if n.Name.Value == EntryLabel {
 				c.a.SetEntry(addr)
 			}
@@ -94,19 +233,70 @@ func (c *Compiler) preproc() {
 		default:
 		}
 	}
+
+	c.size = addr
+
+	// Labels end where the next one starts, the last one ends with the program. Generated labels
+	// are a part of the label they are in.
+	for i, name := range order {
+		end := addr
+		if i + 1 < len(order) {
+			end = c.labels[order[i + 1]].Addr
+		}
+
+		label     := c.labels[name]
+		label.Size = end - label.Addr
+
+		c.labels[name] = label
+	}
+
+	c.checkTables()
 }
 
 func (c *Compiler) compile() {
+	c.declare()
+
+	// Data is placed in the source order, the definitions it uses are resolved when they are first
+	// used. Everything else is resolved once all of the data is placed.
+	for _, s := range c.program.List {
+		if n, ok := s.(*node.Align); ok {
+			c.alignCursor(n.Value)
+		} else if d := c.reach(s); d != nil {
+			c.placeData(d)
+		}
+	}
+
+	c.placeLiterals()
+	c.placeReserved()
+
 	for _, s := range c.program.List {
 		switch n := s.(type) {
-		case *node.Label: continue;
+		case *node.Macro:  c.resolve(n.Name)
+		case *node.Struct: c.resolve(n.Name)
+		case *node.Enum:   c.resolve(n.Name)
+		}
+	}
+
+	// Initialisers can refer to addresses of any variable, so they are evaluated once all of them
+	// are placed
+	c.writeInits()
+	c.checkAsserts()
+	c.a.AddMemoryString(string(c.memory[1:]))
 
-		case *node.Macro: c.compileMacro(n)
-		case *node.Embed: c.compileEmbed(n)
-		case *node.Let:   c.compileLet(n)
-		case *node.Inst:  c.compileInst(n)
+	// In instructions the cursor is the end of the memory
+	c.cursor = c.memoryEnd()
+	c.inInst = true
+	for _, s := range c.program.List {
+		if n, ok := s.(*node.Inst); ok {
+			c.compileInst(n)
+			c.here ++
 		}
 	}
+
+	for _, e := range c.discarded {
+		c.evalExpr(e)
+	}
+	c.inInst = false
 }
 
 func (c *Compiler) redefined(name *node.Id) bool {
@@ -114,12 +304,8 @@ func (c *Compiler) redefined(name *node.Id) bool {
 		goerror.Error(name.Token.Where, "Label '%v' redefined", name.Value)
 		goerror.Note(prev.Token.Where, "Previously defined here")
 		return true
-	} else if prev, ok := c.vars[name.Value]; ok {
-		goerror.Error(name.Token.Where, "Variable '%v' redefined", name.Value)
-		goerror.Note(prev.Token.Where, "Previously defined here")
-		return true
-	} else if prev, ok := c.macros[name.Value]; ok {
-		goerror.Error(name.Token.Where, "Macro '%v' redefined", name.Value)
+	} else if prev, ok := c.decls[name.Value]; ok {
+		goerror.Error(name.Token.Where, "%v '%v' redefined", prev.Kind, name.Value)
 		goerror.Note(prev.Token.Where, "Previously defined here")
 		return true
 	}
@@ -128,68 +314,240 @@ func (c *Compiler) redefined(name *node.Id) bool {
 }
 
 func (c *Compiler) compileMacro(n *node.Macro) {
-	if c.redefined(n.Name) {
+	value := n.Value
+	if def, ok := c.define(n.Name.Value); ok {
+		value = def
+	}
+
+	c.macros[n.Name.Value] = Macro{
+		Token: n.Token,
+		Value: c.evalExpr(value),
+		Float: c.isFloat(value),
+		Expr:  value,
+	}
+}
+
+func (c *Compiler) compileEmbed(n *node.Embed, d *decl) {
+	data, err := os.ReadFile(n.Path.Value)
+	if err != nil {
+		goerror.Error(n.Token.Where, "Could not embed file '%v'", n.Path.Value)
 		return
 	}
 
-	c.macros[n.Name.Value] = Macro{Token: n.Token, Value: c.evalExpr(n.Value)}
+	d.Data = data
+	c.vars[n.Name.Value] = Var{
+		Token: n.Token,
+		Type:  byteType(n.Token),
+		Count: agen.Word(len(data)),
+		Size:  agen.Word(len(data)),
+		Const: n.Const,
+	}
 }
 
-func (c *Compiler) compileEmbed(n *node.Embed) {
-	if c.redefined(n.Name) {
+func (c *Compiler) placeEmbed(n *node.Embed, d *decl) {
+	var_, ok := c.resolvedVar(n.Name)
+	if !ok {
 		return
 	}
 
-	data, err := os.ReadFile(n.Path.Value)
-	if err != nil {
-		goerror.Error(n.Token.Where, "Could not embed file '%v'", n.Path.Value)
+	if n.Const && c.poolable(n.Attrs) {
+		var_.Addr, var_.Alias = c.placePooled(n.Name, d.Data, 1)
+	} else {
+		var_.Addr, var_.Fixed = c.placeVar(n.Name, n.Attrs, var_.Size)
+		c.write(var_.Addr, d.Data)
+	}
+
+	var_.Placed = true
+	c.vars[n.Name.Value] = var_
+}
+
+// Lets are placed with their size only, their initialisers are written once all variables are
+// placed. Pooled constants need their contents to be placed, so they are evaluated right away,
+// unless they use the address of a variable placed after them.
+type pendingInit struct {
+	Name   string
+	Type   *node.Type
+	Values []node.Expr
+	Addr   agen.Word
+	Cursor agen.Word // Cursor before the let, for '$$' in the initialisers
+}
+
+func (c *Compiler) compileLet(n *node.Let, d *decl) {
+	if !c.validType(n.Type) {
 		return
 	}
 
-	size := c.a.MemorySize()
-	addr := c.a.AddMemoryString(string(data))
-	size  = c.a.MemorySize() - size
+	values, count, ok := c.flattenInit(n.Type, n.Values)
+	if !ok {
+		return
+	}
 
-	c.vars[n.Name.Value] = Var{Token: n.Token, Addr: addr, Size: size}
+	d.Values = values
+	c.vars[n.Name.Value] = Var{
+		Token: n.Token,
+		Type:  n.Type,
+		Count: count,
+		Size:  count * c.sizeOfType(n.Type),
+		Const: n.Const,
+	}
 }
 
-func (c *Compiler) compileLet(n *node.Let) {
-	if c.redefined(n.Name) {
+func (c *Compiler) placeLet(n *node.Let, d *decl) {
+	var_, ok := c.resolvedVar(n.Name)
+	if !ok {
 		return
 	}
 
-	list := []agen.Word{}
-	for _, expr := range n.Values {
+	align := c.alignOfType(n.Type)
+	if n.Const && c.poolable(n.Attrs) && !c.usesLaterAddress(d.Values) {
+		data := c.encodeInit(n.Name.Value, n.Type, d.Values)
+		var_.Addr, var_.Alias = c.placePooled(n.Name, data, align)
+	} else {
+		var_.Addr, var_.Fixed = c.placeVar(n.Name, n.Attrs, var_.Size)
+		c.write(var_.Addr, make([]byte, var_.Size))
+		c.inits = append(c.inits, pendingInit{
+			Name:   n.Name.Value,
+			Type:   n.Type,
+			Values: d.Values,
+			Addr:   var_.Addr,
+			Cursor: d.Cursor,
+		})
+	}
+
+	if var_.Addr % align != 0 {
+		goerror.Warning(n.Name.Token.Where, "Variable '%v' of type '%v' is misaligned at address %v",
+		                n.Name.Value, n.Type, var_.Addr)
+		goerror.Note(n.Token.Where, "Align it with '%v %v align %v %v = ...'",
+		             n.Token.Type, n.Name.Value, align, n.Type)
+	}
+
+	var_.Placed = true
+	c.vars[n.Name.Value] = var_
+}
+
+func (c *Compiler) writeInits() {
+	cursor := c.cursor
+	for _, init := range c.inits {
+		c.cursor = init.Cursor
+		c.write(init.Addr, c.encodeInit(init.Name, init.Type, init.Values))
+	}
+
+	c.cursor = cursor
+}
+
+// Encodes the initialisers of a value of the type or an array of them
+func (c *Compiler) initData(name string, t *node.Type,
+                            exprs []node.Expr) (data []byte, count agen.Word, ok bool) {
+	values, count, ok := c.flattenInit(t, exprs)
+	if !ok {
+		return nil, 0, false
+	}
+
+	return c.encodeInit(name, t, values), count, true
+}
+
+// Flattens the initialisers into a value for each slot, fills repeat the same expression
+func (c *Compiler) flattenInit(t *node.Type,
+                               exprs []node.Expr) (values []node.Expr, count agen.Word, ok bool) {
+	for _, expr := range exprs {
 		switch e := expr.(type) {
 		case *node.Fill:
-			count := c.evalExpr(e.Count)
-			value := c.evalExpr(e.Value)
-			for i := agen.Word(0); i < count; i ++ {
-				list = append(list, value)
+			repeat := c.evalExpr(e.Count)
+			for i := agen.Word(0); i < repeat; i ++ {
+				values = append(values, e.Value)
 			}
 
 		case *node.String:
 			for _, ch := range e.Value {
-				list = append(list, agen.Word(ch))
+				values = append(values, &node.Int{Token: e.Token, Value: int64(ch)})
 			}
 
-		default: list = append(list, c.evalExpr(expr))
+		default: values = append(values, expr)
+		}
+	}
+
+	// Structs without members are reported where they are declared
+	slots := c.slots(t)
+	if len(slots) == 0 {
+		return nil, 0, false
+	} else if len(values) % len(slots) != 0 {
+		goerror.Error(t.Token.Where, "Expected a multiple of %v values for struct '%v', got %v",
+		              len(slots), t, len(values))
+		return nil, 0, false
+	}
+
+	return values, agen.Word(len(values) / len(slots)), true
+}
+
+func (c *Compiler) encodeInit(name string, t *node.Type, values []node.Expr) []byte {
+	type evaluated struct {
+		expr node.Expr
+		slot int
+	}
+
+	slots := c.slots(t)
+	size  := c.sizeOfType(t)
+	data  := make([]byte, agen.Word(len(values) / len(slots)) * size)
+	cache := make(map[evaluated]agen.Word)
+	for i, expr := range values {
+		slot := slots[i % len(slots)]
+		key  := evaluated{expr: expr, slot: i % len(slots)}
+
+		value, ok := cache[key]
+		if !ok {
+			value      = c.evalInit(expr, slot.Type, name)
+			cache[key] = value
 		}
+
+		encode(data[agen.Word(i / len(slots)) * size + slot.Offset:], value, slot.Type.Type)
 	}
 
-	size := c.a.MemorySize()
-	addr := c.a.AddMemoryInt(list, n.Type.Type)
-	size  = c.a.MemorySize() - size
+	return data
+}
+
+func (c *Compiler) evalInit(e node.Expr, t *node.Type, name string) agen.Word {
+	if t.Float {
+		value := c.evalFloat(e)
+		if t.Type == agen.I64 {
+			return agen.Word(math.Float64bits(value))
+		}
+
+		if !math.IsInf(value, 0) && math.Abs(value) > math.MaxFloat32 {
+			goerror.Warning(e.GetToken().Where, "Value %v does not fit into type '%v'", value, t)
+		}
+
+		return agen.Word(math.Float32bits(float32(value)))
+	}
+
+	value := c.evalExpr(e)
+	if c.isFloat(e) {
+		goerror.Error(e.GetToken().Where, "Float value assigned into let '%v' of type '%v'", name, t)
+		goerror.Note(t.Token.Where, "Use an explicit conversion '(%v ...)'", t)
+	} else if !fitsInto(value, t.Type) {
+		goerror.Warning(e.GetToken().Where, "Value %v does not fit into type '%v', truncated to %v",
+		                int64(value), t, truncate(value, t.Type))
+	}
+
+	return value
+}
 
-	c.vars[n.Name.Value] = Var{Token: n.Token, Addr: addr, Size: size}
+// Instructions are kept with their evaluated arguments for the analysis passes
+type compiledInst struct {
+	Node *node.Inst
+	Arg  agen.Word
 }
 
 func (c *Compiler) compileInst(n *node.Inst) {
+	inst := compiledInst{Node: n}
 	if n.Arg == nil {
 		c.a.AddInst(n.Name)
 	} else {
-		c.a.AddInstWith(n.Name, c.evalExpr(n.Arg))
+		inst.Arg = c.evalArg(n)
+		c.a.AddInstWith(n.Name, inst.Arg)
+		c.checkOperand(inst)
 	}
+
+	c.insts = append(c.insts, inst)
 }
 
 func (c *Compiler) evalExpr(e node.Expr) agen.Word {
@@ -197,21 +555,56 @@ func (c *Compiler) evalExpr(e node.Expr) agen.Word {
 	case *node.Int:   return agen.Word(n.Value)
 	case *node.Float: return agen.Word(math.Float64bits(n.Value))
 	case *node.Id:
+		if !c.resolve(n) {
+			return 0
+		}
+
+		c.used[n.Value] = true
 		if label, ok := c.labels[n.Value]; ok {
 			return label.Addr
 		} else if var_, ok := c.vars[n.Value]; ok {
-			return var_.Addr
+			return c.addrOf(n, var_)
 		} else if macro, ok := c.macros[n.Value]; ok {
 			return macro.Value
+		} else if _, ok := c.structs[n.Value]; ok {
+			goerror.Error(n.Token.Where, "Unexpected struct '%v' in constant expression", n.Value)
+		} else if _, ok := c.enums[n.Value]; ok {
+			goerror.Error(n.Token.Where, "Unexpected enum '%v' in constant expression", n.Value)
 		} else {
 			goerror.Error(n.Token.Where, "Undefined identifier '%v'", n.Value)
 		}
 
-	case *node.BinOp:  return c.evalBinOp(n)
-	case *node.SizeOf: return c.evalSizeOf(n)
+	case *node.BinOp:    return c.evalBinOp(n)
+	case *node.SizeOf:   return c.evalSizeOf(n)
+	case *node.CountOf:  return c.evalCountOf(n)
+	case *node.ElemSize: return c.evalElemSize(n)
+	case *node.TypeOf:   return c.evalTypeOf(n)
+	case *node.At:       return c.evalAt(n)
+	case *node.OffsetOf: return c.evalOffsetOf(n)
+	case *node.Field:    return c.evalField(n)
+	case *node.Cast:     return c.evalCast(n)
+
+	case *node.String, *node.Array:
+		lit, _ := c.evalLiteral(n)
+		return lit.Addr
+
+	case *node.Here:
+		if !c.inInst {
+			goerror.Error(n.Token.Where, "'%v' can only be used in instruction operands", n)
+		}
+
+		return c.here
+
+	case *node.Cursor:
+		if c.unreached != nil {
+			goerror.Error(n.Token.Where,
+			              "'%v' is not known in '%v', which is used before its place in memory",
+			              n, c.unreached.Name.Value)
+		}
+
+		return c.cursor
 
 	case *node.Type:   goerror.Error(n.Token.Where, "Unexpected type in constant expression")
-	case *node.String: goerror.Error(n.Token.Where, "Unexpected string in constant expression")
 	case *node.Fill:   goerror.Error(n.Token.Where, "Unexpected fill in constant expression")
 	default: goerror.Error(n.GetToken().Where, "Unexpected %v in constant expression", n.GetToken())
 	}
@@ -219,30 +612,229 @@ func (c *Compiler) evalExpr(e node.Expr) agen.Word {
 	return 0;
 }
 
+func (c *Compiler) lookupVar(n *node.Id, what string) (Var, bool) {
+	if !c.resolve(n) {
+		return Var{}, false
+	}
+
+	c.used[n.Value] = true
+	if _, ok := c.labels[n.Value]; ok {
+		goerror.Error(n.Token.Where, "Cannot get %v of label '%v'", what, n.Value)
+	} else if var_, ok := c.vars[n.Value]; ok {
+		return var_, true
+	} else if _, ok := c.macros[n.Value]; ok {
+		goerror.Error(n.Token.Where, "Cannot get %v of macro '%v'", what, n.Value)
+	} else if _, ok := c.structs[n.Value]; ok {
+		goerror.Error(n.Token.Where, "Cannot get %v of struct '%v'", what, n.Value)
+	} else if _, ok := c.enums[n.Value]; ok {
+		goerror.Error(n.Token.Where, "Cannot get %v of enum '%v'", what, n.Value)
+	} else {
+		goerror.Error(n.Token.Where, "Undefined identifier '%v'", n.Value)
+	}
+
+	return Var{}, false
+}
+
 func (c *Compiler) evalSizeOf(n *node.SizeOf) agen.Word {
+	if n.Literal != nil {
+		lit, _ := c.evalLiteral(n.Literal)
+		return lit.Size
+	} else if n.Id == nil {
+		return typeSize(n.Type.Type)
+	} else if !c.resolve(n.Id) {
+		return 0
+	} else if s, ok := c.structs[n.Id.Value]; ok {
+		return s.Size
+	} else if label, ok := c.labels[n.Id.Value]; ok {
+		c.used[n.Id.Value] = true
+		return label.Size
+	}
+
+	var_, _ := c.lookupVar(n.Id, "size")
+	return var_.Size
+}
+
+func (c *Compiler) evalCountOf(n *node.CountOf) agen.Word {
+	if !c.resolve(n.Id) {
+		return 0
+	} else if e, ok := c.enums[n.Id.Value]; ok {
+		return agen.Word(len(e.Members))
+	}
+
+	var_, _ := c.lookupVar(n.Id, "count")
+	return var_.Count
+}
+
+func (c *Compiler) evalElemSize(n *node.ElemSize) agen.Word {
 	if n.Id == nil {
-		switch n.Type.Type {
-		case agen.I8:  return 1
-		case agen.I16: return 2
-		case agen.I32: return 4
-		case agen.I64: return 8
-		}
-	} else {
-		if _, ok := c.labels[n.Id.Value]; ok {
-			goerror.Error(n.Token.Where, "Cannot get size of label '%v'", n.Id.Value)
-		} else if var_, ok := c.vars[n.Id.Value]; ok {
-			return var_.Size
-		} else if _, ok := c.macros[n.Id.Value]; ok {
-			goerror.Error(n.Token.Where, "Cannot get size of macro '%v'", n.Id.Value)
-		} else {
-			goerror.Error(n.Token.Where, "Undefined identifier '%v'", n.Id.Value)
+		return typeSize(n.Type.Type)
+	} else if !c.resolve(n.Id) {
+		return 0
+	} else if s, ok := c.structs[n.Id.Value]; ok {
+		return s.Size
+	}
+
+	if var_, ok := c.lookupVar(n.Id, "element size"); ok {
+		return c.sizeOfType(var_.Type)
+	}
+
+	return 0
+}
+
+func (c *Compiler) evalTypeOf(n *node.TypeOf) agen.Word {
+	if n.Id == nil {
+		return c.typeId(n.Type)
+	} else if !c.resolve(n.Id) {
+		return 0
+	} else if s, ok := c.structs[n.Id.Value]; ok {
+		return s.Id
+	}
+
+	// Macros are untyped constants, so they are either an i64 or an f64
+	if macro, ok := c.macros[n.Id.Value]; ok {
+		c.used[n.Id.Value] = true
+		if macro.Float {
+			return c.typeId(&node.Type{Type: agen.I64, Float: true})
 		}
+
+		return c.typeId(&node.Type{Type: agen.I64})
+	}
+
+	if var_, ok := c.lookupVar(n.Id, "type"); ok {
+		return c.typeId(var_.Type)
 	}
 
 	return 0
 }
 
+func (c *Compiler) evalAt(n *node.At) agen.Word {
+	var_, ok := c.lookupVar(n.Id, "element")
+	index    := c.evalExpr(n.Index)
+	if !ok {
+		return 0
+	}
+
+	if int64(index) < 0 || index >= var_.Count {
+		goerror.Error(n.Index.GetToken().Where, "Index %v out of bounds of '%v' with %v elements",
+		              int64(index), n.Id.Value, var_.Count)
+		goerror.Note(var_.Token.Where, "Declared here")
+	}
+
+	return c.addrOf(n.Id, var_) + index * c.sizeOfType(var_.Type)
+}
+
+func (c *Compiler) evalCast(n *node.Cast) agen.Word {
+	if n.Type.Float {
+		value := c.evalFloat(n.Value)
+		if n.Type.Type == agen.I32 {
+			value = float64(float32(value))
+		}
+
+		return agen.Word(math.Float64bits(value))
+	}
+
+	value := c.evalExpr(n.Value)
+	if c.isFloat(n.Value) {
+		value = agen.Word(int64(math.Float64frombits(uint64(value))))
+	}
+
+	return truncate(value, n.Type.Type)
+}
+
+// Evaluates an expression as a float, converting integers
+func (c *Compiler) evalFloat(e node.Expr) float64 {
+	value := c.evalExpr(e)
+	if c.isFloat(e) {
+		return math.Float64frombits(uint64(value))
+	}
+
+	return float64(int64(value))
+}
+
+func (c *Compiler) isFloat(e node.Expr) bool {
+	switch n := e.(type) {
+	case *node.Float: return true
+	case *node.Cast:  return n.Type.Float
+	case *node.Id:    return c.resolve(n) && c.macros[n.Value].Float
+	case *node.BinOp:
+		if !isArithmetic(n.Op) {
+			return false
+		}
+
+		for _, arg := range n.Args {
+			if c.isFloat(arg) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func byteType(tok token.Token) *node.Type {
+	tok.Type, tok.Data = token.TypeByte, "byte"
+	return &node.Type{Token: tok, Type: agen.I8}
+}
+
+// Identifies a type in typeof, 'char' is the same type as 'byte'
+func (c *Compiler) typeId(t *node.Type) agen.Word {
+	if t.Struct != nil {
+		return c.structs[t.Struct.Value].Id
+	}
+
+	id := agen.Word(t.Type) + 1
+	if t.Float {
+		id += 4
+	}
+
+	return id
+}
+
+func typeSize(type_ agen.Type) agen.Word {
+	switch type_ {
+	case agen.I8:  return 1
+	case agen.I16: return 2
+	case agen.I32: return 4
+	case agen.I64: return 8
+
+	default: panic("Unreachable")
+	}
+}
+
+// Writes a value big endian, like the memory of AGEN
+func encode(data []byte, value agen.Word, type_ agen.Type) {
+	size := typeSize(type_)
+	for i := agen.Word(0); i < size; i ++ {
+		data[i] = byte(value >> ((size - i - 1) * 8))
+	}
+}
+
+func fitsInto(value agen.Word, type_ agen.Type) bool {
+	bits := typeSize(type_) * 8
+	if bits == 64 {
+		return true
+	}
+
+	signed := int64(value)
+	return signed >= -(1 << (bits - 1)) && signed < 1 << bits
+}
+
+func truncate(value agen.Word, type_ agen.Type) agen.Word {
+	bits := typeSize(type_) * 8
+	if bits == 64 {
+		return value
+	}
+
+	return value & (1 << bits - 1)
+}
+
 func (c *Compiler) evalBinOp(n *node.BinOp) agen.Word {
+	if isComparison(n.Op) {
+		return c.evalComparison(n)
+	} else if c.isFloat(n) {
+		return c.evalFloatBinOp(n)
+	}
+
 	result := c.evalExpr(n.Args[0])
 	for i, expr := range n.Args {
 		if i == 0 {
@@ -256,8 +848,104 @@ func (c *Compiler) evalBinOp(n *node.BinOp) agen.Word {
 		case "/": result /= c.evalExpr(expr)
 		case "%": result %= c.evalExpr(expr)
 		case "^": result  = agen.Word(math.Pow(float64(result), float64(c.evalExpr(expr))))
+
+		case "&":  result &=  c.evalExpr(expr)
+		case "|":  result |=  c.evalExpr(expr)
+		case ">>": result >>= c.evalExpr(expr)
+		case "<<": result <<= c.evalExpr(expr)
 		}
 	}
 
 	return result
 }
+
+func (c *Compiler) evalFloatBinOp(n *node.BinOp) agen.Word {
+	result := c.evalFloat(n.Args[0])
+	for i, expr := range n.Args {
+		if i == 0 {
+			continue
+		}
+
+		switch n.Op {
+		case "+": result += c.evalFloat(expr)
+		case "-": result -= c.evalFloat(expr)
+		case "*": result *= c.evalFloat(expr)
+		case "/": result /= c.evalFloat(expr)
+		case "%": result  = math.Mod(result, c.evalFloat(expr))
+		case "^": result  = math.Pow(result, c.evalFloat(expr))
+		}
+	}
+
+	return agen.Word(math.Float64bits(result))
+}
+
+// Comparisons with more than 2 arguments are chained, (< a b c) is a < b and b < c
+func (c *Compiler) evalComparison(n *node.BinOp) agen.Word {
+	float := false
+	for _, arg := range n.Args {
+		if c.isFloat(arg) {
+			float = true
+		}
+	}
+
+	ints   := []int64{}
+	floats := []float64{}
+	for _, arg := range n.Args {
+		if float {
+			floats = append(floats, c.evalFloat(arg))
+		} else {
+			ints = append(ints, int64(c.evalExpr(arg)))
+		}
+	}
+
+	for i := 1; i < len(n.Args); i ++ {
+		var order int
+		if float {
+			order = compare(floats[i - 1] < floats[i], floats[i - 1] > floats[i])
+		} else {
+			order = compare(ints[i - 1] < ints[i], ints[i - 1] > ints[i])
+		}
+
+		var ok bool
+		switch n.Op {
+		case "==": ok = order == 0
+		case "!=": ok = order != 0
+		case ">":  ok = order >  0
+		case ">=": ok = order >= 0
+		case "<":  ok = order <  0
+		case "<=": ok = order <= 0
+		}
+
+		if !ok {
+			return 0
+		}
+	}
+
+	return 1
+}
+
+func compare(less, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+
+	return 0
+}
+
+func isArithmetic(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "%", "^": return true
+
+	default: return false
+	}
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", ">", ">=", "<", "<=": return true
+
+	default: return false
+	}
+}
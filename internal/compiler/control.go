@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Structured control flow is lowered into jumps to generated labels. Their names contain dots,
+// so they can not collide with the labels of the program.
+func (c *Compiler) lower(list []node.Statement) (lowered []node.Statement) {
+	for _, s := range list {
+		switch n := s.(type) {
+		case *node.If:    lowered = append(lowered, c.lowerIf(n)...)
+		case *node.While: lowered = append(lowered, c.lowerWhile(n)...)
+		case *node.Loop:  lowered = append(lowered, c.lowerLoop(n)...)
+		case *node.Proc:  lowered = append(lowered, c.lowerProc(n)...)
+		case *node.Break:
+			// Breaks outside of loops are reported by the parser
+			if len(c.loopEnds) > 0 {
+				lowered = append(lowered, jumpTo(n.Token, "jmp", c.loopEnds[len(c.loopEnds) - 1]))
+			}
+
+		default: lowered = append(lowered, s)
+		}
+	}
+
+	return
+}
+
+func (c *Compiler) genLabels(kind string, parts... string) (labels []*node.Label) {
+	c.generated ++
+	for _, part := range parts {
+		labels = append(labels, &node.Label{
+			Name:      &node.Id{Value: fmt.Sprintf("%v.%v.%v", kind, c.generated, part)},
+			Generated: true,
+		})
+	}
+
+	return
+}
+
+func at(label *node.Label, tok token.Token) *node.Label {
+	label.Token, label.Name.Token = tok, tok
+	return label
+}
+
+func jumpTo(tok token.Token, inst string, label *node.Label) *node.Inst {
+	return &node.Inst{
+		Token:     tok,
+		Name:      inst,
+		Arg:       &node.Id{Token: tok, Value: label.Name.Value},
+		Generated: true,
+	}
+}
+
+//   jnz then, jmp else, then: THEN, jmp end, else: ELSE, end:
+func (c *Compiler) lowerIf(n *node.If) (lowered []node.Statement) {
+	labels := c.genLabels("if", "then", "else", "end")
+	then, else_, end := labels[0], labels[1], labels[2]
+
+	lowered = append(lowered, jumpTo(n.Token, "jnz", then))
+	if n.Else == nil {
+		lowered = append(lowered, jumpTo(n.Token, "jmp", end))
+	} else {
+		lowered = append(lowered, jumpTo(n.Token, "jmp", else_))
+	}
+
+	lowered = append(lowered, at(then, n.Token))
+	lowered = append(lowered, c.lower(n.Then)...)
+
+	if n.Else != nil {
+		lowered = append(lowered, jumpTo(n.ElseToken, "jmp", end), at(else_, n.ElseToken))
+		lowered = append(lowered, c.lower(n.Else)...)
+	}
+
+	return append(lowered, at(end, n.EndToken))
+}
+
+//   top: COND, jnz body, jmp end, body: BODY, jmp top, end:
+func (c *Compiler) lowerWhile(n *node.While) (lowered []node.Statement) {
+	labels := c.genLabels("while", "top", "body", "end")
+	top, body, end := labels[0], labels[1], labels[2]
+
+	lowered = append(lowered, at(top, n.Token))
+	lowered = append(lowered, c.lower(n.Cond)...)
+	lowered = append(lowered, jumpTo(n.DoToken, "jnz", body), jumpTo(n.DoToken, "jmp", end))
+	lowered = append(lowered, at(body, n.DoToken))
+
+	c.loopEnds = append(c.loopEnds, end)
+	lowered    = append(lowered, c.lower(n.Body)...)
+	c.loopEnds = c.loopEnds[:len(c.loopEnds) - 1]
+
+	return append(lowered, jumpTo(n.EndToken, "jmp", top), at(end, n.EndToken))
+}
+
+//   top: BODY, jmp top, end:
+func (c *Compiler) lowerLoop(n *node.Loop) (lowered []node.Statement) {
+	labels := c.genLabels("loop", "top", "end")
+	top, end := labels[0], labels[1]
+
+	lowered = append(lowered, at(top, n.Token))
+
+	c.loopEnds = append(c.loopEnds, end)
+	lowered    = append(lowered, c.lower(n.Body)...)
+	c.loopEnds = c.loopEnds[:len(c.loopEnds) - 1]
+
+	return append(lowered, jumpTo(n.EndToken, "jmp", top), at(end, n.EndToken))
+}
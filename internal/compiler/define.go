@@ -0,0 +1,63 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"strconv"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Command line definitions in the form NAME=VALUE, or NAME for a value of 1. They override
+// macros with the same name, so macros can be used as defaults for configurations.
+func (c *Compiler) Define(def string) error {
+	name, value, hasValue := strings.Cut(def, "=")
+	if !hasValue {
+		value = "1"
+	}
+
+	if len(name) == 0 {
+		return fmt.Errorf("Expected a name in definition '%v'", def)
+	}
+
+	tok := token.Token{
+		Type: token.Id,
+		Data: name,
+		Where: token.Where{
+			Row:  1,
+			Col:  4,
+			Len:  len(name),
+			Path: "command line",
+			Line: "-D " + def,
+		},
+	}
+
+	var expr node.Expr
+	if i, err := strconv.ParseInt(value, 0, 64); err == nil {
+		tok.Type = token.Dec
+		expr     = &node.Int{Token: tok, Value: i}
+	} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+		tok.Type = token.Float
+		expr     = &node.Float{Token: tok, Value: f}
+	} else {
+		return fmt.Errorf("Invalid value '%v' of definition '%v'", value, name)
+	}
+
+	c.defines = append(c.defines, &node.Macro{
+		Token: tok,
+		Name:  &node.Id{Token: tok, Value: name},
+		Value: expr,
+	})
+	return nil
+}
+
+func (c *Compiler) define(name string) (node.Expr, bool) {
+	for i := len(c.defines) - 1; i >= 0; i -- {
+		if c.defines[i].Name.Value == name {
+			return c.defines[i].Value, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,60 @@
+package compiler
+
+import (
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+type Enum struct {
+	Token   token.Token
+	Members []string
+}
+
+func (c *Compiler) compileEnum(n *node.Enum) {
+	e := Enum{Token: n.Token}
+	for _, m := range n.Members {
+		if c.isMemberOf(n, m) {
+			c.resolve(m.Name)
+			e.Members = append(e.Members, m.Name.Value)
+		}
+	}
+
+	c.enums[n.Name.Value] = e
+}
+
+// Enum members are macros, consecutive or powers of two for flag enums
+func (c *Compiler) compileEnumMember(n *node.Enum, m *node.EnumMember) {
+	value, float := agen.Word(0), false
+	if n.Flags {
+		value = 1
+	}
+
+	if m.Value != nil {
+		value, float = c.evalExpr(m.Value), c.isFloat(m.Value)
+	} else if prev := c.prevMember(n, m); prev != nil {
+		c.resolve(prev.Name)
+
+		prevValue := c.macros[prev.Name.Value].Value
+		if n.Flags {
+			for value = 1; value != 0 && value <= prevValue; value <<= 1 {}
+		} else {
+			value = prevValue + 1
+		}
+	}
+
+	c.macros[m.Name.Value] = Macro{Token: m.Token, Value: value, Float: float}
+}
+
+func (c *Compiler) prevMember(n *node.Enum, m *node.EnumMember) (prev *node.EnumMember) {
+	for _, member := range n.Members {
+		if member == m {
+			break
+		} else if c.isMemberOf(n, member) {
+			prev = member
+		}
+	}
+
+	return
+}
@@ -0,0 +1,326 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Code starting at a label which is followed through jumps and calls. Routines without a
+// procedure start with an empty stack and do not return, unless they are summarised.
+type routine struct {
+	Name  string
+	Start agen.Word
+	End   agen.Word // First instruction after the routine
+	Proc  *node.Proc
+}
+
+func (r routine) inputs() int {
+	if r.Proc == nil {
+		return 0
+	}
+
+	return len(r.Proc.Inputs)
+}
+
+// Stack effect of a called label without a signature, found by following it from an unknown
+// stack. Labels which are still being summarised, never return or return with different depths
+// are unknown.
+type summary struct {
+	Known   bool
+	Needs   int // Values it uses from below the stack it was called with
+	Effect  int
+	returns bool
+}
+
+type path struct {
+	Addr  agen.Word
+	Depth int       // Stack depth relative to the start of the routine
+	From  agen.Word // Instruction which led to the address
+}
+
+// Every instruction is visited once, with the depth of the first path reaching it, other paths
+// reaching it are compared to that depth
+type walker struct {
+	routine
+
+	depths  map[agen.Word]int
+	paths   []path
+	fellOff bool
+	summary *summary
+}
+
+// Follows every path through the procedures and the code from the entry point, checking that
+// the procedures keep to their signatures, that nothing uses more values than there are on the
+// stack and that paths meet with the same stack depth
+func (c *Compiler) checkFlow() {
+	for _, p := range c.procs {
+		c.walk(routine{
+			Name:  p.Node.Name.Value,
+			Start: c.labels[p.Node.Name.Value].Addr,
+			End:   c.labels[p.End.Name.Value].Addr,
+			Proc:  p.Node,
+		}, nil)
+	}
+
+	if entry, ok := c.labels[EntryLabel]; ok && c.procAt(entry.Addr) == nil {
+		c.walk(routine{Name: EntryLabel, Start: entry.Addr, End: agen.Word(len(c.insts))}, nil)
+	}
+}
+
+func (c *Compiler) walk(r routine, s *summary) {
+	w := &walker{
+		routine: r,
+		depths:  make(map[agen.Word]int),
+		paths:   []path{{Addr: r.Start, From: r.Start}},
+		summary: s,
+	}
+
+	for len(w.paths) > 0 {
+		p := w.paths[len(w.paths) - 1]
+		w.paths = w.paths[:len(w.paths) - 1]
+
+		for c.step(w, &p) {}
+	}
+}
+
+func (c *Compiler) summarise(addr agen.Word) *summary {
+	if s, ok := c.summaries[addr]; ok {
+		return s
+	}
+
+	s := &summary{}
+	c.summaries[addr] = s
+	c.walk(routine{Start: addr, End: agen.Word(len(c.insts))}, s)
+
+	s.Known = s.returns
+	return s
+}
+
+// Simulates the instruction at the path, false when the path ends
+func (c *Compiler) step(w *walker, p *path) bool {
+	if p.Addr >= w.End {
+		if w.Proc != nil && p.Addr == w.End {
+			c.reportFallOff(w)
+		}
+
+		return false
+	} else if depth, ok := w.depths[p.Addr]; ok {
+		if depth != p.Depth {
+			c.reportJoin(w, p, depth)
+		}
+
+		return false
+	}
+
+	w.depths[p.Addr] = p.Depth
+
+	inst := c.insts[p.Addr]
+	n    := inst.Node
+	if !c.require(w, n, p.Depth, needs(inst)) {
+		return false
+	}
+
+	switch n.Name {
+	case "ret":
+		if w.Proc != nil {
+			c.checkReturn(w, n, p.Depth)
+		} else if w.summary != nil {
+			c.summariseReturn(w, p.Depth)
+		}
+
+		return false
+
+	case "hlt": return false
+	case "jmp": return c.jump(w, p, inst)
+	case "jnz":
+		p.Depth --
+
+		branch := *p
+		if c.jump(w, &branch, inst) {
+			w.paths = append(w.paths, branch)
+		}
+
+	case "cal":
+		effect, ok := c.call(w, p, inst)
+		if !ok {
+			return false
+		}
+
+		p.Depth += effect
+
+	case "dup": p.Depth ++
+	case "swp":
+	default:
+		effect := Insts[n.Name]
+		if effect.Pops == Unknown {
+			return false
+		}
+
+		p.Depth += effect.Pushes - effect.Pops
+	}
+
+	p.From = p.Addr
+	p.Addr ++
+	return true
+}
+
+// Values an instruction uses from the stack, 'dup' and 'swp' reach as deep as their argument
+func needs(inst compiledInst) int {
+	switch inst.Node.Name {
+	case "dup": return int(inst.Arg) + 1
+	case "swp": return int(inst.Arg) + 2
+
+	default: return Insts[inst.Node.Name].Pops
+	}
+}
+
+// Checks that there are enough values on the stack, summarised labels record what they need
+// instead, since their stack is not known
+func (c *Compiler) require(w *walker, n *node.Inst, depth, values int) bool {
+	available := w.inputs() + depth
+	if available >= values {
+		return true
+	} else if w.summary != nil {
+		if values - available > w.summary.Needs {
+			w.summary.Needs = values - available
+		}
+
+		return true
+	}
+
+	goerror.Warning(n.Token.Where,
+	                "Possible stack underflow, '%v' uses %v value%v, but the stack holds %v",
+	                n.Name, values, plural(values), available)
+	return false
+}
+
+func (c *Compiler) summariseReturn(w *walker, depth int) {
+	if !w.summary.returns {
+		w.summary.returns, w.summary.Effect = true, depth
+	} else if w.summary.Effect != depth {
+		// Returns with different depths leave the effect unknown
+		w.summary.returns = false
+	}
+}
+
+// The stack effect of a call, calls into labels with an unknown summary or without enough values
+// for the callee end the path
+func (c *Compiler) call(w *walker, p *path, inst compiledInst) (int, bool) {
+	if callee := c.procAt(inst.Arg); callee != nil {
+		if !c.checkCall(w, inst.Node, callee, p.Depth) {
+			return 0, false
+		}
+
+		return len(callee.Outputs) - len(callee.Inputs), true
+	} else if !c.jumpsIntoCode(inst) {
+		return 0, false
+	}
+
+	s := c.summarise(inst.Arg)
+	if !s.Known {
+		return 0, false
+	} else if !c.require(w, inst.Node, p.Depth, s.Needs) {
+		return 0, false
+	}
+
+	return s.Effect, true
+}
+
+// Moves the path to the jump target, procedures can only be left by returning or by a jump into
+// another procedure, which returns for them. Any routine can jump into a procedure this way. Tail
+// calls made by the optimiser return for them too, with the effect of the label they jump to, or
+// the path ends if it is not known.
+func (c *Compiler) jump(w *walker, p *path, inst compiledInst) bool {
+	target := inst.Arg
+	p.From  = p.Addr
+	if !c.jumpsIntoCode(inst) {
+		return false
+	}
+
+	if callee := c.procAt(target); callee != nil && callee != w.Proc && inst.Node.Name == "jmp" {
+		if !c.checkCall(w, inst.Node, callee, p.Depth) {
+			return false
+		}
+
+		depth := p.Depth + len(callee.Outputs) - len(callee.Inputs)
+		if w.Proc != nil {
+			c.checkReturn(w, inst.Node, depth)
+		} else if w.summary != nil {
+			c.summariseReturn(w, depth)
+		}
+
+		return false
+	} else if w.Proc == nil {
+		p.Addr = target
+		return true
+	} else if target < w.Start || target > w.End {
+		if !c.tailCalls[inst.Node] {
+			c.reportJumpOut(w, inst.Node)
+		} else if effect, ok := c.call(w, p, inst); ok {
+			c.checkReturn(w, inst.Node, p.Depth + effect)
+		}
+
+		return false
+	}
+
+	p.Addr = target
+	return true
+}
+
+// Jumps backwards are loops, which have to leave the stack as it was at their start. Paths in a
+// procedure can not all keep to its signature if they join with different depths.
+func (c *Compiler) reportJoin(w *walker, p *path, depth int) {
+	from, to := c.insts[p.From].Node, c.insts[p.Addr].Node
+	if w.Proc != nil {
+		c.reportProcJoin(w, to, depth, p.Depth)
+		return
+	}
+
+	diff := p.Depth - depth
+	if p.From >= p.Addr {
+		goerror.Warning(from.Token.Where,
+		                "Unbalanced loop, the stack %v by %v value%v every iteration",
+		                growsOrShrinks(diff), abs(diff), plural(diff))
+		goerror.Note(to.Token.Where, "Loop starts here")
+	} else {
+		goerror.Warning(from.Token.Where,
+		                "Paths join with %v %v value%v on the stack than another path",
+		                abs(diff), moreOrFewer(diff), plural(diff))
+		goerror.Note(to.Token.Where, "Paths join here")
+	}
+}
+
+func growsOrShrinks(diff int) string {
+	if diff > 0 {
+		return "grows"
+	}
+
+	return "shrinks"
+}
+
+func moreOrFewer(diff int) string {
+	if diff > 0 {
+		return "more"
+	}
+
+	return "fewer"
+}
+
+// Suffix for a count of values in messages
+func plural(count int) string {
+	if abs(count) == 1 {
+		return ""
+	}
+
+	return "s"
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -1,107 +1,140 @@
 package compiler
 
+// Stack effects of instructions with an unknown effect, like calling native functions
+const Unknown = -1
+
+// Stack depth the indexes of 'dup' and 'swp' are checked against. It is an assumption, not read
+// from the VM, so deeper indexes only warn.
+const StackSize = 1024
+
+// What the argument of an instruction is, which decides the values it can take
+type Operand int
+
+const (
+	Immediate   Operand = iota // Any value
+	StackIndex                 // Counted from the top of the stack, up to the largest index
+	CodeAddress                // Address of an instruction of the program
+)
+
+func (o Operand) String() string {
+	switch o {
+	case StackIndex:  return "stack index"
+	case CodeAddress: return "code address"
+
+	default: return "immediate"
+	}
+}
+
 type Inst struct {
-	Op     byte
-	HasArg bool
+	Op      byte
+	HasArg  bool
+	Operand Operand
+	MaxArg  int64 // Largest stack index, the deepest value has to be on the stack
+
+	// How many values the instruction pops from the stack and pushes onto it, instructions which
+	// move values around (swp) have no effect. Stack operands are listed from the top of the
+	// stack, 'w64' expects the value on top and the address below it, 'set' and 'cpy' expect the
+	// destination address below their other two operands.
+	Pops, Pushes int
 }
 
 var (
 	Insts = map[string]Inst{
-		"nop": Inst{Op: 0x00},
-
-		"psh": Inst{Op: 0x10, HasArg: true},
-		"pop": Inst{Op: 0x11},
-
-		"add": Inst{Op: 0x20},
-		"sub": Inst{Op: 0x21},
-
-		"mul": Inst{Op: 0x22},
-		"div": Inst{Op: 0x23},
-		"mod": Inst{Op: 0x24},
-
-		"inc": Inst{Op: 0x25},
-		"dec": Inst{Op: 0x26},
-
-		"fad": Inst{Op: 0x27},
-		"fsb": Inst{Op: 0x28},
-
-		"fmu": Inst{Op: 0x29},
-		"fdi": Inst{Op: 0x2a},
-
-		"fin": Inst{Op: 0x2b},
-		"fde": Inst{Op: 0x2c},
-
-		"neg": Inst{Op: 0x2d},
-		"not": Inst{Op: 0x2e},
-
-		"jmp": Inst{Op: 0x30, HasArg: true},
-		"jnz": Inst{Op: 0x31, HasArg: true},
-
-		"cal": Inst{Op: 0x38, HasArg: true},
-		"ret": Inst{Op: 0x39},
-
-		"and": Inst{Op: 0x46},
-		"orr": Inst{Op: 0x47},
-
-		"equ": Inst{Op: 0x32},
-		"neq": Inst{Op: 0x33},
-		"grt": Inst{Op: 0x34},
-		"geq": Inst{Op: 0x35},
-		"les": Inst{Op: 0x36},
-		"leq": Inst{Op: 0x37},
-
-		"ueq": Inst{Op: 0x3a},
-		"une": Inst{Op: 0x3b},
-		"ugr": Inst{Op: 0x3c},
-		"ugq": Inst{Op: 0x3d},
-		"ule": Inst{Op: 0x3e},
-		"ulq": Inst{Op: 0x3f},
-
-		"feq": Inst{Op: 0x40},
-		"fne": Inst{Op: 0x41},
-		"fgr": Inst{Op: 0x42},
-		"fgq": Inst{Op: 0x43},
-		"fle": Inst{Op: 0x44},
-		"flq": Inst{Op: 0x45},
-
-		"dup": Inst{Op: 0x50, HasArg: true},
-		"swp": Inst{Op: 0x51, HasArg: true},
-		"emp": Inst{Op: 0x52},
-		"set": Inst{Op: 0x53},
-		"cpy": Inst{Op: 0x54},
-
-		"r08": Inst{Op: 0x60},
-		"r16": Inst{Op: 0x61},
-		"r32": Inst{Op: 0x62},
-		"r64": Inst{Op: 0x63},
-
-		"w08": Inst{Op: 0x64},
-		"w16": Inst{Op: 0x65},
-		"w32": Inst{Op: 0x66},
-		"w64": Inst{Op: 0x67},
-
-		"ope": Inst{Op: 0x70},
-		"clo": Inst{Op: 0x71},
-		"wrf": Inst{Op: 0x72},
-		"rdf": Inst{Op: 0x73},
-		"szf": Inst{Op: 0x74},
-		"flu": Inst{Op: 0x75},
-
-		"ban": Inst{Op: 0x80},
-		"bor": Inst{Op: 0x81},
-		"bsr": Inst{Op: 0x82},
-		"bsl": Inst{Op: 0x83},
-
-		"lol": Inst{Op: 0x90},
-		"cll": Inst{Op: 0x91},
-		"llf": Inst{Op: 0x92},
-		"ulf": Inst{Op: 0x93},
-		"clf": Inst{Op: 0x94},
-
-		"dmp": Inst{Op: 0xF0},
-		"prt": Inst{Op: 0xF1},
-		"fpr": Inst{Op: 0xF2},
-
-		"hlt": Inst{Op: 0xFF},
+		"nop": Inst{Op: 0x00, Pops: 0, Pushes: 0},
+
+		"psh": Inst{Op: 0x10, HasArg: true, Operand: Immediate, Pops: 0, Pushes: 1},
+		"pop": Inst{Op: 0x11, Pops: 1, Pushes: 0},
+
+		"add": Inst{Op: 0x20, Pops: 2, Pushes: 1},
+		"sub": Inst{Op: 0x21, Pops: 2, Pushes: 1},
+
+		"mul": Inst{Op: 0x22, Pops: 2, Pushes: 1},
+		"div": Inst{Op: 0x23, Pops: 2, Pushes: 1},
+		"mod": Inst{Op: 0x24, Pops: 2, Pushes: 1},
+
+		"inc": Inst{Op: 0x25, Pops: 1, Pushes: 1},
+		"dec": Inst{Op: 0x26, Pops: 1, Pushes: 1},
+
+		"fad": Inst{Op: 0x27, Pops: 2, Pushes: 1},
+		"fsb": Inst{Op: 0x28, Pops: 2, Pushes: 1},
+
+		"fmu": Inst{Op: 0x29, Pops: 2, Pushes: 1},
+		"fdi": Inst{Op: 0x2a, Pops: 2, Pushes: 1},
+
+		"fin": Inst{Op: 0x2b, Pops: 1, Pushes: 1},
+		"fde": Inst{Op: 0x2c, Pops: 1, Pushes: 1},
+
+		"neg": Inst{Op: 0x2d, Pops: 1, Pushes: 1},
+		"not": Inst{Op: 0x2e, Pops: 1, Pushes: 1},
+
+		"jmp": Inst{Op: 0x30, HasArg: true, Operand: CodeAddress, Pops: 0, Pushes: 0},
+		"jnz": Inst{Op: 0x31, HasArg: true, Operand: CodeAddress, Pops: 1, Pushes: 0},
+
+		"cal": Inst{Op: 0x38, HasArg: true, Operand: CodeAddress, Pops: 0, Pushes: 0},
+		"ret": Inst{Op: 0x39, Pops: 0, Pushes: 0},
+
+		"and": Inst{Op: 0x46, Pops: 2, Pushes: 1},
+		"orr": Inst{Op: 0x47, Pops: 2, Pushes: 1},
+
+		"equ": Inst{Op: 0x32, Pops: 2, Pushes: 1},
+		"neq": Inst{Op: 0x33, Pops: 2, Pushes: 1},
+		"grt": Inst{Op: 0x34, Pops: 2, Pushes: 1},
+		"geq": Inst{Op: 0x35, Pops: 2, Pushes: 1},
+		"les": Inst{Op: 0x36, Pops: 2, Pushes: 1},
+		"leq": Inst{Op: 0x37, Pops: 2, Pushes: 1},
+
+		"ueq": Inst{Op: 0x3a, Pops: 2, Pushes: 1},
+		"une": Inst{Op: 0x3b, Pops: 2, Pushes: 1},
+		"ugr": Inst{Op: 0x3c, Pops: 2, Pushes: 1},
+		"ugq": Inst{Op: 0x3d, Pops: 2, Pushes: 1},
+		"ule": Inst{Op: 0x3e, Pops: 2, Pushes: 1},
+		"ulq": Inst{Op: 0x3f, Pops: 2, Pushes: 1},
+
+		"feq": Inst{Op: 0x40, Pops: 2, Pushes: 1},
+		"fne": Inst{Op: 0x41, Pops: 2, Pushes: 1},
+		"fgr": Inst{Op: 0x42, Pops: 2, Pushes: 1},
+		"fgq": Inst{Op: 0x43, Pops: 2, Pushes: 1},
+		"fle": Inst{Op: 0x44, Pops: 2, Pushes: 1},
+		"flq": Inst{Op: 0x45, Pops: 2, Pushes: 1},
+
+		"dup": Inst{Op: 0x50, HasArg: true, Operand: StackIndex, MaxArg: StackSize - 1, Pops: 0, Pushes: 1},
+		"swp": Inst{Op: 0x51, HasArg: true, Operand: StackIndex, MaxArg: StackSize - 2, Pops: 0, Pushes: 0},
+		"emp": Inst{Op: 0x52, Pops: 0, Pushes: 1},
+		"set": Inst{Op: 0x53, Pops: 3, Pushes: 0},
+		"cpy": Inst{Op: 0x54, Pops: 3, Pushes: 0},
+
+		"r08": Inst{Op: 0x60, Pops: 1, Pushes: 1},
+		"r16": Inst{Op: 0x61, Pops: 1, Pushes: 1},
+		"r32": Inst{Op: 0x62, Pops: 1, Pushes: 1},
+		"r64": Inst{Op: 0x63, Pops: 1, Pushes: 1},
+
+		"w08": Inst{Op: 0x64, Pops: 2, Pushes: 0},
+		"w16": Inst{Op: 0x65, Pops: 2, Pushes: 0},
+		"w32": Inst{Op: 0x66, Pops: 2, Pushes: 0},
+		"w64": Inst{Op: 0x67, Pops: 2, Pushes: 0},
+
+		"ope": Inst{Op: 0x70, Pops: 3, Pushes: 1},
+		"clo": Inst{Op: 0x71, Pops: 1, Pushes: 0},
+		"wrf": Inst{Op: 0x72, Pops: 3, Pushes: 0},
+		"rdf": Inst{Op: 0x73, Pops: 3, Pushes: 0},
+		"szf": Inst{Op: 0x74, Pops: 1, Pushes: 1},
+		"flu": Inst{Op: 0x75, Pops: 1, Pushes: 0},
+
+		"ban": Inst{Op: 0x80, Pops: 2, Pushes: 1},
+		"bor": Inst{Op: 0x81, Pops: 2, Pushes: 1},
+		"bsr": Inst{Op: 0x82, Pops: 2, Pushes: 1},
+		"bsl": Inst{Op: 0x83, Pops: 2, Pushes: 1},
+
+		"lol": Inst{Op: 0x90, Pops: 2, Pushes: 1},
+		"cll": Inst{Op: 0x91, Pops: 1, Pushes: 0},
+		"llf": Inst{Op: 0x92, Pops: 3, Pushes: 1},
+		"ulf": Inst{Op: 0x93, Pops: 1, Pushes: 0},
+		"clf": Inst{Op: 0x94, Pops: Unknown},
+
+		"dmp": Inst{Op: 0xF0, Pops: 0, Pushes: 0},
+		"prt": Inst{Op: 0xF1, Pops: 1, Pushes: 0},
+		"fpr": Inst{Op: 0xF2, Pops: 1, Pushes: 0},
+
+		"hlt": Inst{Op: 0xFF, Pops: 1, Pushes: 0},
 	}
 )
@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+)
+
+// Jumps and calls accept any constant expression, but only addresses of instructions make sense
+// for them. Addresses outside of the program are reported with the operand. Generated jumps
+// always go to labels.
+func (c *Compiler) checkJumps() {
+	for _, inst := range c.insts {
+		n := inst.Node
+		if n.Generated || Insts[n.Name].Operand != CodeAddress {
+			continue
+		}
+
+		where := n.Arg.GetToken().Where
+		if name, var_, ok := c.varTarget(n.Arg); ok {
+			goerror.Warning(where, "'%v' to the memory address of '%v' instead of a label",
+			                n.Name, name)
+			goerror.Note(var_.Token.Where, "'%v' declared here", name)
+		}
+	}
+}
+
+// Jumps into memory or outside of the program are reported once and not followed by the analysis
+func (c *Compiler) jumpsIntoCode(inst compiledInst) bool {
+	if inst.Node.Generated {
+		return true
+	} else if _, _, ok := c.varTarget(inst.Node.Arg); ok {
+		return false
+	}
+
+	return inst.Arg < agen.Word(len(c.insts))
+}
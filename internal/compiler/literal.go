@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// A literal evaluated before it is placed
+type literal struct {
+	Expr  node.Expr
+	Data  []byte
+	Align agen.Word
+	Var   Var
+}
+
+// String and array literals in instruction operands are placed as anonymous constants after the
+// initialised data. Identical literals always share the same memory, with pooling they can also
+// share the memory of constants. Longer literals are placed first, so that shorter ones can share
+// their ends.
+func (c *Compiler) placeLiterals() {
+	var lits []literal
+	for _, s := range c.program.List {
+		if n, ok := s.(*node.Inst); ok && n.Arg != nil {
+			lits = c.literalsIn(n.Arg, lits)
+		}
+	}
+
+	sort.SliceStable(lits, func(i, j int) bool {
+		return len(lits[i].Data) > len(lits[j].Data)
+	})
+
+	for _, lit := range lits {
+		if addr, _, ok := c.findPooled(lit.Data, lit.Align); ok {
+			lit.Var.Addr = addr
+		} else {
+			lit.Var.Addr = c.place(lit.Var.Size, lit.Align)
+			c.write(lit.Var.Addr, lit.Data)
+
+			c.pool      = append(c.pool, blob{Addr: lit.Var.Addr, Data: string(lit.Data)})
+			c.anonymous = append(c.anonymous, lit.Expr)
+		}
+
+		c.literals[lit.Expr] = lit.Var
+	}
+}
+
+func (c *Compiler) literalsIn(e node.Expr, lits []literal) []literal {
+	switch n := e.(type) {
+	case *node.String: return c.newLiteral(n, byteType(n.Token), []node.Expr{n}, lits)
+	case *node.Array:
+		if c.validType(n.Type) {
+			return c.newLiteral(n, n.Type, n.Values, lits)
+		}
+
+	case *node.BinOp:
+		for _, arg := range n.Args {
+			lits = c.literalsIn(arg, lits)
+		}
+
+	case *node.SizeOf:
+		if n.Literal != nil {
+			return c.literalsIn(n.Literal, lits)
+		}
+
+	case *node.At:   return c.literalsIn(n.Index, lits)
+	case *node.Cast: return c.literalsIn(n.Value, lits)
+	}
+
+	return lits
+}
+
+func (c *Compiler) newLiteral(e node.Expr, t *node.Type, values []node.Expr,
+                            lits []literal) []literal {
+	data, count, ok := c.initData(e.String(), t, values)
+	if !ok {
+		return lits
+	}
+
+	return append(lits, literal{
+		Expr:  e,
+		Data:  data,
+		Align: c.alignOfType(t),
+		Var:   Var{
+			Token: e.GetToken(),
+			Type:  t,
+			Count: count,
+			Size:  agen.Word(len(data)),
+			Const: true,
+		},
+	})
+}
+
+func literalName(e node.Expr) string {
+	if n, ok := e.(*node.String); ok {
+		return fmt.Sprintf("%q", n.Value)
+	}
+
+	return e.String()
+}
+
+func (c *Compiler) evalLiteral(e node.Expr) (Var, bool) {
+	lit, ok := c.literals[e]
+	if !ok {
+		goerror.Error(e.GetToken().Where, "Literal %v can only be used in instruction operands",
+		              literalName(e))
+	}
+
+	return lit, ok
+}
@@ -0,0 +1,238 @@
+package compiler
+
+import (
+	"io"
+	"fmt"
+	"sort"
+
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Variables are placed at the cursor, skipping over the ones with fixed addresses. Fixed
+// variables can go anywhere in the memory, as long as they do not overlap other variables.
+func (c *Compiler) placeVar(name *node.Id, attrs node.Attrs, size agen.Word) (agen.Word, bool) {
+	align, ok := agen.Word(1), true
+	if attrs.Align != nil {
+		if align, ok = c.evalAlign(attrs.Align); !ok {
+			return 0, false
+		}
+	}
+
+	if attrs.Org == nil {
+		return c.place(size, align), false
+	}
+
+	addr := c.evalExpr(attrs.Org)
+	if addr == 0 {
+		goerror.Error(attrs.Org.GetToken().Where, "Address 0 is always the null byte")
+		return 0, true
+	} else if addr % align != 0 {
+		goerror.Error(attrs.Org.GetToken().Where, "Address %v is not aligned to %v", addr, align)
+		return addr, true
+	}
+
+	for prevName, prev := range c.vars {
+		if !prev.Placed {
+			continue
+		}
+
+		if overlaps(addr, size, prev.Addr, prev.Size) {
+			goerror.Error(attrs.Org.GetToken().Where,
+			              "Variable '%v' at %v-%v overlaps variable '%v' at %v-%v",
+			              name.Value, addr, addr + size, prevName, prev.Addr, prev.Addr + prev.Size)
+			goerror.Note(prev.Token.Where, "'%v' declared here", prevName)
+			return addr, true
+		}
+	}
+
+	c.fixed = append(c.fixed, Var{Addr: addr, Size: size})
+	return addr, true
+}
+
+func (c *Compiler) place(size, align agen.Word) agen.Word {
+	addr := alignUp(c.cursor, align)
+	for moved := true; moved; {
+		moved = false
+		for _, fixed := range c.fixed {
+			if overlaps(addr, size, fixed.Addr, fixed.Size) {
+				addr  = alignUp(fixed.Addr + fixed.Size, align)
+				moved = true
+			}
+		}
+	}
+
+	c.cursor = addr + size
+	return addr
+}
+
+func (c *Compiler) write(addr agen.Word, data []byte) {
+	if end := addr + agen.Word(len(data)); end > agen.Word(len(c.memory)) {
+		c.memory = append(c.memory, make([]byte, end - agen.Word(len(c.memory)))...)
+	}
+
+	copy(c.memory[addr:], data)
+}
+
+func overlaps(a, aSize, b, bSize agen.Word) bool {
+	return aSize > 0 && bSize > 0 && a < b + bSize && b < a + aSize
+}
+
+func (c *Compiler) evalAlign(e node.Expr) (agen.Word, bool) {
+	align := c.evalExpr(e)
+	if align == 0 || align & (align - 1) != 0 {
+		goerror.Error(e.GetToken().Where, "Alignment must be a power of 2, got %v", int64(align))
+		return 1, false
+	}
+
+	return align, true
+}
+
+// Moves the cursor up to a multiple of the alignment, the skipped memory stays zero
+func (c *Compiler) alignCursor(e node.Expr) {
+	if align, ok := c.evalAlign(e); ok {
+		c.cursor = alignUp(c.cursor, align)
+	}
+}
+
+// Reserved memory is placed after all of the initialised data, past the end of the memory written
+// into the executable. AVM executables have no section for uninitialised memory, so its size is
+// only recorded in the memory layout and symbol maps.
+func (c *Compiler) compileReserve(n *node.Reserve) {
+	size := c.evalExpr(n.Size)
+	if int64(size) < 0 {
+		goerror.Error(n.Size.GetToken().Where, "Reserved size must not be negative, got %v",
+		              int64(size))
+		return
+	}
+
+	c.vars[n.Name.Value] = Var{
+		Token:    n.Token,
+		Type:     byteType(n.Token),
+		Count:    size,
+		Size:     size,
+		Reserved: true,
+	}
+}
+
+// Reserved memory at a fixed address is placed where it is, the rest after all initialised data
+func (c *Compiler) placeReserve(n *node.Reserve) {
+	var_, ok := c.resolvedVar(n.Name)
+	if !ok {
+		return
+	} else if n.Org == nil {
+		c.reserved = append(c.reserved, n)
+		return
+	}
+
+	var_.Addr, var_.Fixed = c.placeVar(n.Name, n.Attrs, var_.Size)
+	var_.Placed = true
+	c.vars[n.Name.Value] = var_
+}
+
+func (c *Compiler) placeReserved() {
+	c.cursor = agen.Word(len(c.memory))
+	for _, n := range c.reserved {
+		var_ := c.vars[n.Name.Value]
+		var_.Addr, _ = c.placeVar(n.Name, n.Attrs, var_.Size)
+		var_.Placed  = true
+		c.vars[n.Name.Value] = var_
+	}
+}
+
+// End of the memory including the reserved memory, which the executable leaves out
+func (c *Compiler) memoryEnd() agen.Word {
+	end := agen.Word(len(c.memory))
+	for _, var_ := range c.vars {
+		if var_.Placed && var_.Addr + var_.Size > end {
+			end = var_.Addr + var_.Size
+		}
+	}
+
+	return end
+}
+
+func (c *Compiler) addrOf(n *node.Id, var_ Var) agen.Word {
+	if var_.Placed {
+		return var_.Addr
+	}
+
+	if var_.Reserved {
+		goerror.Error(n.Token.Where,
+		              "Address of reserved '%v' is not known until all initialised data is placed",
+		              n.Value)
+		goerror.Note(var_.Token.Where, "Reserved here")
+	} else {
+		goerror.Error(n.Token.Where, "Address of '%v' is not known before it is placed", n.Value)
+		goerror.Note(var_.Token.Where, "'%v' declared here", n.Value)
+	}
+
+	return 0
+}
+
+func (c *Compiler) WriteLayout(w io.Writer) {
+	vars  := make(map[string]Var)
+	names := []string{}
+	for name, var_ := range c.vars {
+		vars[name] = var_
+		names      = append(names, name)
+	}
+
+	for _, e := range c.anonymous {
+		name := literalName(e)
+		vars[name] = c.literals[e]
+		names      = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, b := vars[names[i]], vars[names[j]]
+		if a.Addr != b.Addr {
+			return a.Addr < b.Addr
+		}
+
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintf(w, "%8v %8v  %-9v %-9v %v\n", "Address", "Size", "Kind", "Placement", "Name")
+
+	var initialised, reserved agen.Word
+	end := agen.Word(1) // The first byte of the memory is always 0
+	for _, name := range names {
+		var_ := vars[name]
+		if var_.Addr > end {
+			fmt.Fprintf(w, "%8v %8v  padding\n", end, var_.Addr - end)
+		}
+
+		kind := "data"
+		if var_.Reserved {
+			kind      = "reserved"
+			reserved += var_.Size
+		} else {
+			if var_.Const {
+				kind = "const"
+			}
+
+			if len(var_.Alias) == 0 {
+				initialised += var_.Size
+			}
+		}
+
+		placement := "auto"
+		if var_.Fixed {
+			placement = "fixed"
+		} else if len(var_.Alias) > 0 {
+			placement = "shared"
+		}
+
+		fmt.Fprintf(w, "%8v %8v  %-9v %-9v %v\n", var_.Addr, var_.Size, kind, placement, name)
+		if var_.Addr + var_.Size > end {
+			end = var_.Addr + var_.Size
+		}
+	}
+
+	fmt.Fprintf(w, "\nInitialised: %v bytes, reserved: %v bytes, total memory: %v bytes\n",
+	            initialised, reserved, c.memoryEnd())
+	fmt.Fprintf(w, "Written into the executable: %v bytes\n", c.a.MemorySize())
+}
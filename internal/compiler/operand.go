@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+)
+
+// Arguments are checked against the operand of their instruction once evaluated. Negative stack
+// indexes can never work, indexes deeper than the assumed stack size and addresses out of range
+// only warn, since they might be intended. Generated instructions always have valid arguments.
+func (c *Compiler) checkOperand(inst compiledInst) {
+	n := inst.Node
+	if n.Generated {
+		return
+	}
+
+	where := n.Arg.GetToken().Where
+	switch op := Insts[n.Name]; op.Operand {
+	case StackIndex:
+		if index := int64(inst.Arg); index < 0 {
+			goerror.Error(where, "'%v' takes a %v from 0, got %v", n.Name, op.Operand, index)
+		} else if index > op.MaxArg {
+			goerror.Warning(where, "'%v' reaches %v values deep, the stack is assumed to hold %v",
+			                n.Name, needs(inst), StackSize)
+		}
+
+	case CodeAddress:
+		// Jumps into memory are reported by the jump check
+		if _, _, ok := c.varTarget(n.Arg); ok {
+			break
+		} else if inst.Arg >= c.size {
+			goerror.Warning(where,
+			                "'%v' takes a %v, %v is outside of the program with %v instructions",
+			                n.Name, op.Operand, int64(inst.Arg), c.size)
+		}
+	}
+}
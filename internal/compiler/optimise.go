@@ -0,0 +1,321 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Optimisation levels, every level includes the ones below it
+const (
+	OptNone     = iota
+	OptPeephole // Folds constants and removes instructions without an effect
+	OptControl  // Shortens jumps and calls
+)
+
+func (c *Compiler) Optimise(level int) {
+	c.optLevel = level
+}
+
+// The lowered program is rewritten before labels get their addresses, so the addresses account
+// for removed instructions. Code addresses given as numbers are not adjusted, and neither are
+// operands relative to '$', so labels using '$' are left as they are.
+func (c *Compiler) optimise(list []node.Statement) []node.Statement {
+	if c.optLevel < OptPeephole {
+		return list
+	}
+
+	list = c.peephole(list)
+	if c.optLevel >= OptControl {
+		c.threadJumps(list)
+	}
+
+	return list
+}
+
+// Rewrites instructions at the end of the output as they are added, so rewritten instructions can
+// be rewritten again with the ones before them. Labels and other statements between instructions
+// keep them apart.
+func (c *Compiler) peephole(list []node.Statement) (out []node.Statement) {
+	relative := relativeInsts(list)
+	for _, s := range list {
+		out = append(out, s)
+		if n, ok := s.(*node.Inst); ok && relative[n] {
+			continue
+		}
+
+		for {
+			if rewritten, ok := c.rewrite(out); ok {
+				out = rewritten
+			} else {
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+func (c *Compiler) rewrite(out []node.Statement) ([]node.Statement, bool) {
+	tail := lastInsts(out, 3)
+	switch len(tail) {
+	case 3:
+		if folded, ok := c.fold(tail[0], tail[1], tail[2]); ok {
+			return append(out[:len(out) - 3], folded), true
+		}
+
+		fallthrough
+
+	case 2:
+		a, b := tail[len(tail) - 2], tail[len(tail) - 1]
+		if a.Name == "psh" && b.Name == "pop" && !hasLiteral(a.Arg) {
+			c.discard(a)
+			return out[:len(out) - 2], true
+		} else if c.optLevel >= OptControl && a.Name == "cal" && b.Name == "ret" {
+			a.Name = "jmp"
+			c.tailCalls[a] = true
+			return out[:len(out) - 1], true
+		}
+
+		fallthrough
+
+	case 1:
+		if tail[len(tail) - 1].Name == "nop" {
+			return out[:len(out) - 1], true
+		}
+	}
+
+	return out, false
+}
+
+// Instructions of labels with an operand relative to '$', removing or folding any of them would
+// move what it refers to. Relative operands are expected to stay inside of their label.
+func relativeInsts(list []node.Statement) map[*node.Inst]bool {
+	relative := make(map[*node.Inst]bool)
+
+	var (
+		insts []*node.Inst
+		here  bool
+	)
+	flush := func() {
+		for _, n := range insts {
+			relative[n] = here
+		}
+
+		insts, here = nil, false
+	}
+
+	for _, s := range list {
+		switch n := s.(type) {
+		case *node.Label:
+			if !n.Generated {
+				flush()
+			}
+
+		case *node.Inst:
+			insts = append(insts, n)
+			here  = here || n.Arg != nil && hasHere(n.Arg)
+		}
+	}
+
+	flush()
+	return relative
+}
+
+func hasHere(e node.Expr) bool {
+	switch n := e.(type) {
+	case *node.Here:  return true
+	case *node.BinOp:
+		for _, arg := range n.Args {
+			if hasHere(arg) {
+				return true
+			}
+		}
+
+	case *node.At:   return hasHere(n.Index)
+	case *node.Cast: return hasHere(n.Value)
+	}
+
+	return false
+}
+
+// Up to n instructions from the end of the list, if nothing else is between them
+func lastInsts(list []node.Statement, n int) []*node.Inst {
+	var insts []*node.Inst
+	for i := len(list) - 1; i >= 0 && len(insts) < n; i -- {
+		inst, ok := list[i].(*node.Inst)
+		if !ok {
+			break
+		}
+
+		insts = append([]*node.Inst{inst}, insts...)
+	}
+
+	return insts
+}
+
+// Instructions which are folded, with the constant expression operator shown for them
+var foldable = map[string]string{
+	"add": "+", "sub": "-", "mul": "*", "ban": "&", "bor": "|",
+	"fad": "+", "fsb": "-", "fmu": "*", "fdi": "/",
+}
+
+// Two pushes and an operation on them, the pushed values are only known once the program is
+// compiled, so the folded push keeps the instructions it replaces
+type folded struct {
+	A, B *node.Inst
+	Op   string
+}
+
+func (c *Compiler) fold(a, b, op *node.Inst) (*node.Inst, bool) {
+	operator, ok := foldable[op.Name]
+	if !ok || a.Name != "psh" || b.Name != "psh" {
+		return nil, false
+	}
+
+	n := &node.Inst{
+		Token:     a.Token,
+		Name:      "psh",
+		Arg:       &node.BinOp{Token: op.Token, Op: operator, Args: []node.Expr{a.Arg, b.Arg}},
+		Generated: a.Generated && b.Generated && op.Generated,
+	}
+
+	c.folds[n] = folded{A: a, B: b, Op: op.Name}
+	return n, true
+}
+
+// Folded pushes are evaluated like the VM runs the instructions they replace
+func (c *Compiler) evalArg(n *node.Inst) agen.Word {
+	f, ok := c.folds[n]
+	if !ok {
+		return c.evalExpr(n.Arg)
+	}
+
+	a, b := c.evalArg(f.A), c.evalArg(f.B)
+	x, y := math.Float64frombits(uint64(a)), math.Float64frombits(uint64(b))
+	switch f.Op {
+	case "add": return a + b
+	case "sub": return a - b
+	case "mul": return a * b
+	case "ban": return a & b
+	case "bor": return a | b
+
+	case "fad": return agen.Word(math.Float64bits(x + y))
+	case "fsb": return agen.Word(math.Float64bits(x - y))
+	case "fmu": return agen.Word(math.Float64bits(x * y))
+	default:    return agen.Word(math.Float64bits(x / y))
+	}
+}
+
+// Removed operands are still evaluated to report their errors
+func (c *Compiler) discard(n *node.Inst) {
+	if f, ok := c.folds[n]; ok {
+		c.discard(f.A)
+		c.discard(f.B)
+	} else {
+		c.discarded = append(c.discarded, n.Arg)
+	}
+}
+
+// Literals are only placed into memory for operands which are compiled
+func hasLiteral(e node.Expr) bool {
+	switch n := e.(type) {
+	case *node.String, *node.Array: return true
+	case *node.BinOp:
+		for _, arg := range n.Args {
+			if hasLiteral(arg) {
+				return true
+			}
+		}
+
+	case *node.SizeOf: return n.Literal != nil
+	case *node.At:     return hasLiteral(n.Index)
+	case *node.Cast:   return hasLiteral(n.Value)
+	}
+
+	return false
+}
+
+func (c *Compiler) isProc(e node.Expr) bool {
+	id, ok := e.(*node.Id)
+	if !ok {
+		return false
+	}
+
+	for _, p := range c.procs {
+		if p.Node.Name.Value == id.Value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Jumps and calls to a label which only jumps further go straight to where that jump leads.
+// Procedures are not jumped through, since calling them checks their signature, and neither are
+// written jumps after generated labels, which would become unreachable.
+func (c *Compiler) threadJumps(list []node.Statement) {
+	labels := make(map[string]*node.Label)
+	firsts := make(map[string]*node.Inst) // First instruction after each label
+	var pending []*node.Label
+	for _, s := range list {
+		switch n := s.(type) {
+		case *node.Label:
+			labels[n.Name.Value] = n
+			pending = append(pending, n)
+
+		case *node.Inst:
+			for _, label := range pending {
+				firsts[label.Name.Value] = n
+			}
+
+			pending = nil
+		}
+	}
+
+	for _, s := range list {
+		n, ok := s.(*node.Inst)
+		if !ok {
+			continue
+		}
+
+		switch n.Name {
+		case "jmp", "jnz", "cal":
+		default: continue
+		}
+
+		target, ok := n.Arg.(*node.Id)
+		if !ok {
+			continue
+		}
+
+		name    := target.Value
+		visited := map[string]bool{name: true}
+		for {
+			label, ok := labels[name]
+			if !ok || c.isProc(label.Name) {
+				break
+			}
+
+			next, ok := firsts[name]
+			if !ok || next.Name != "jmp" || (label.Generated && !next.Generated) {
+				break
+			}
+
+			id, ok := next.Arg.(*node.Id)
+			if !ok || visited[id.Value] {
+				break
+			}
+
+			name, visited[id.Value] = id.Value, true
+		}
+
+		if name != target.Value {
+			// The label jumped through is still used by the code
+			c.used[target.Value] = true
+			n.Arg = &node.Id{Token: target.Token, Value: name}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Read-only data placed in the memory, which later read-only data with the same contents can
+// share. With pooling the data can also be the end of a longer blob, like the "world" in
+// "Hello, world". Constants are placed in the source order, so they can only share the end of a
+// longer constant declared before them.
+type blob struct {
+	Addr  agen.Word
+	Data  string
+	Owner string // Variable owning the memory, empty for literals
+}
+
+func (c *Compiler) UsePooling(pooling bool) {
+	c.pooling = pooling
+}
+
+func (c *Compiler) findPooled(data []byte, align agen.Word) (agen.Word, string, bool) {
+	if len(data) == 0 {
+		return 0, "", false
+	}
+
+	for _, b := range c.pool {
+		if len(b.Data) != len(data) && !c.pooling {
+			continue
+		} else if !strings.HasSuffix(b.Data, string(data)) {
+			continue
+		}
+
+		if addr := b.Addr + agen.Word(len(b.Data) - len(data)); addr % align == 0 {
+			return addr, b.Owner, true
+		}
+	}
+
+	return 0, "", false
+}
+
+// Constants without placement attributes share memory with identical constants placed before
+func (c *Compiler) poolable(attrs node.Attrs) bool {
+	return c.pooling && attrs.Align == nil && attrs.Org == nil
+}
+
+// Pooled constants are evaluated when they are placed, so ones using the address of a variable
+// which is not placed yet are left to be written with the other initialisers instead
+func (c *Compiler) usesLaterAddress(values []node.Expr) bool {
+	seen := make(map[string]bool)
+	for _, e := range values {
+		if c.refersToLater(e, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Compiler) refersToLater(e node.Expr, seen map[string]bool) bool {
+	switch n := e.(type) {
+	case *node.Id:
+		d, ok := c.decls[n.Value]
+		if !ok || seen[n.Value] {
+			return false
+		}
+		seen[n.Value] = true
+
+		if d.Kind == "Variable" {
+			return !c.vars[n.Value].Placed
+		} else if d.Member != nil {
+			return d.Member.Value != nil && c.refersToLater(d.Member.Value, seen)
+		} else if m, ok := d.Node.(*node.Macro); ok {
+			value := m.Value
+			if def, ok := c.define(n.Value); ok {
+				value = def
+			}
+
+			return c.refersToLater(value, seen)
+		}
+
+	case *node.BinOp:
+		for _, arg := range n.Args {
+			if c.refersToLater(arg, seen) {
+				return true
+			}
+		}
+
+	case *node.At:    return c.refersToLater(n.Id, seen) || c.refersToLater(n.Index, seen)
+	case *node.Field: return c.refersToLater(n.Id, seen)
+	case *node.Cast:  return c.refersToLater(n.Value, seen)
+	}
+
+	return false
+}
+
+func (c *Compiler) placePooled(name *node.Id, data []byte, align agen.Word) (agen.Word, string) {
+	if addr, owner, ok := c.findPooled(data, align); ok {
+		return addr, owner
+	}
+
+	addr, _ := c.placeVar(name, node.Attrs{}, agen.Word(len(data)))
+	c.write(addr, data)
+	c.pool = append(c.pool, blob{Addr: addr, Data: string(data), Owner: name.Value})
+	return addr, ""
+}
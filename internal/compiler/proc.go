@@ -0,0 +1,81 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+type proc struct {
+	Node *node.Proc
+	End  *node.Label // Generated label after the body
+}
+
+//   NAME: BODY, end:
+func (c *Compiler) lowerProc(n *node.Proc) (lowered []node.Statement) {
+	end := at(c.genLabels("proc", "end")[0], n.EndToken)
+	c.procs = append(c.procs, proc{Node: n, End: end})
+
+	lowered = append(lowered, &node.Label{Token: n.Token, Name: n.Name})
+	lowered = append(lowered, c.lower(n.Body)...)
+	return append(lowered, end)
+}
+
+func (c *Compiler) procAt(addr agen.Word) *node.Proc {
+	for _, p := range c.procs {
+		if c.labels[p.Node.Name.Value].Addr == addr {
+			return p.Node
+		}
+	}
+
+	return nil
+}
+
+// False when there are not enough values on the stack for the callee
+func (c *Compiler) checkCall(w *walker, n *node.Inst, callee *node.Proc, depth int) bool {
+	if w.summary != nil {
+		return c.require(w, n, depth, len(callee.Inputs))
+	}
+
+	inputs := len(callee.Inputs)
+	if available := w.inputs() + depth; available < inputs {
+		goerror.Error(n.Token.Where, "Procedure '%v' takes %v value%v, but the stack holds %v",
+		              callee.Name.Value, inputs, plural(inputs), available)
+		goerror.Note(callee.Token.Where, "'%v' declared here", callee.Name.Value)
+		return false
+	}
+
+	return true
+}
+
+func (c *Compiler) checkReturn(w *walker, n *node.Inst, depth int) {
+	if values := w.inputs() + depth; values != len(w.Proc.Outputs) {
+		goerror.Error(n.Token.Where, "Procedure '%v' returns %v value%v, its signature declares %v",
+		              w.Name, values, plural(values), len(w.Proc.Outputs))
+		goerror.Note(w.Proc.Token.Where, "'%v' declared here", w.Name)
+	}
+}
+
+// Paths which meet with different depths can not all return what the signature declares
+func (c *Compiler) reportProcJoin(w *walker, n *node.Inst, depth, other int) {
+	goerror.Error(n.Token.Where, "Paths in procedure '%v' join with %v and %v values on the stack",
+	              w.Name, w.inputs() + depth, w.inputs() + other)
+	goerror.Note(w.Proc.Token.Where, "'%v' declared here", w.Name)
+}
+
+func (c *Compiler) reportFallOff(w *walker) {
+	if w.fellOff {
+		return
+	}
+
+	w.fellOff = true
+	goerror.Error(w.Proc.EndToken.Where, "Procedure '%v' can reach '%v' without returning",
+	              w.Name, token.EndProc)
+}
+
+func (c *Compiler) reportJumpOut(w *walker, n *node.Inst) {
+	goerror.Error(n.Token.Where, "Jump out of procedure '%v'", w.Name)
+	goerror.Note(w.Proc.Token.Where, "'%v' declared here", w.Name)
+}
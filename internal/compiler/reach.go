@@ -0,0 +1,105 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Instructions after a 'jmp', 'ret' or 'hlt' can only run if a label or a jump leads to them.
+// Labels of the program are always treated as reachable, generated labels only when something
+// jumps to them.
+func (c *Compiler) checkReachability() {
+	targets  := make(map[agen.Word]bool)
+	routines := make(map[agen.Word]bool) // Labels which are called
+	for _, inst := range c.insts {
+		if !c.jumpsIntoCode(inst) {
+			continue
+		}
+
+		switch inst.Node.Name {
+		case "jmp", "jnz": targets[inst.Arg] = true
+		case "cal":        targets[inst.Arg], routines[inst.Arg] = true, true
+		}
+	}
+
+	for _, table := range c.tables {
+		for _, label := range table.Labels {
+			targets[c.labels[label.Value].Addr] = true
+		}
+	}
+
+	for _, p := range c.procs {
+		routines[c.labels[p.Node.Name.Value].Addr] = true
+	}
+
+	labels := c.labelsByAddr()
+
+	var (
+		prev *node.Inst // Instruction before, if it continues to the next one
+		end  *node.Inst // Instruction after which the code is unreachable
+
+		reported bool
+	)
+	for i, inst := range c.insts {
+		addr := agen.Word(i)
+		if label, ok := labels[addr]; ok || targets[addr] {
+			if ok && prev != nil && routines[addr] {
+				goerror.Warning(prev.Token.Where, "Execution falls through into routine '%v'",
+				                label.Name.Value)
+				goerror.Note(label.Token.Where, "'%v' starts here", label.Name.Value)
+			}
+
+			end = nil
+		} else if prev == nil && end == nil && i > 0 {
+			end, reported = c.insts[i - 1].Node, false
+		}
+
+		// Generated instructions after a 'ret' in a block are expected to be unreachable
+		if end != nil && !reported && !inst.Node.Generated {
+			goerror.Warning(inst.Node.Token.Where, "Unreachable code after '%v'", instName(end))
+			reported = true
+		}
+
+		prev = nil
+		if end == nil && !endsFlow(inst.Node.Name) {
+			prev = inst.Node
+		}
+	}
+}
+
+// Generated instructions are named by the keyword they come from
+func instName(n *node.Inst) string {
+	if n.Generated {
+		return n.Token.Data
+	}
+
+	return n.Name
+}
+
+func endsFlow(name string) bool {
+	switch name {
+	case "jmp", "ret", "hlt": return true
+
+	default: return false
+	}
+}
+
+// The first label of the program at each address
+func (c *Compiler) labelsByAddr() map[agen.Word]*node.Label {
+	labels := make(map[agen.Word]*node.Label)
+	for _, s := range c.program.List {
+		n, ok := s.(*node.Label)
+		if !ok || n.Generated {
+			continue
+		}
+
+		addr := c.labels[n.Name.Value].Addr
+		if _, ok := labels[addr]; !ok {
+			labels[addr] = n
+		}
+	}
+
+	return labels
+}
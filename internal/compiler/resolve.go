@@ -0,0 +1,204 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+type declState int
+const (
+	unresolved = declState(iota)
+	resolving
+	resolved
+)
+
+// A named definition, resolved when it is first used. Data is placed when the source order
+// reaches it, everything else is resolved after all of the data.
+type decl struct {
+	Token token.Token
+	Name  *node.Id
+	Kind  string
+
+	Node   node.Statement
+	Member *node.EnumMember // Set for enum members, the node is their enum
+	Id     agen.Word        // Type identifier of structs
+
+	State declState
+	Cycle bool // Already reported as part of a cycle
+
+	// Cursor where the placement of data reaches the definition, for '$$'
+	Cursor  agen.Word
+	Reached bool
+
+	Values []node.Expr // Flattened initialisers of lets
+	Data   []byte      // Contents of embedded files
+}
+
+// Registers all definitions, so that they can be used before they are defined
+func (c *Compiler) declare() {
+	for _, s := range c.program.List {
+		switch n := s.(type) {
+		case *node.Macro:   c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Macro",    Node: n})
+		case *node.Let:     c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Variable", Node: n})
+		case *node.Embed:   c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Variable", Node: n})
+		case *node.Reserve: c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Variable", Node: n})
+		case *node.Table:   c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Variable", Node: n})
+		case *node.Struct:
+			c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Struct", Node: n,
+			                Id: structTypeIdStart + agen.Word(len(c.structIds))})
+			c.structIds = append(c.structIds, n.Name.Value)
+
+		case *node.Enum:
+			c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Enum", Node: n})
+			for _, m := range n.Members {
+				c.addDecl(&decl{Token: m.Token, Name: m.Name, Kind: "Macro", Node: n, Member: m})
+			}
+		}
+	}
+
+	// Command line definitions override macros, otherwise they are new macros
+	seen := make(map[string]bool)
+	for _, n := range c.defines {
+		if seen[n.Name.Value] {
+			continue
+		}
+		seen[n.Name.Value] = true
+
+		if d, ok := c.decls[n.Name.Value]; ok && d.Kind == "Macro" && d.Member == nil {
+			continue
+		}
+
+		c.addDecl(&decl{Token: n.Token, Name: n.Name, Kind: "Macro", Node: n})
+	}
+}
+
+func (c *Compiler) addDecl(d *decl) {
+	if !c.redefined(d.Name) {
+		c.decls[d.Name.Value] = d
+	}
+}
+
+// Definitions currently being resolved form a chain, using one of them again means there is a
+// cycle, which is the only case where this fails. Undefined identifiers are left to the caller.
+func (c *Compiler) resolve(n *node.Id) bool {
+	d, ok := c.decls[n.Value]
+	if !ok {
+		return true
+	}
+
+	switch d.State {
+	case resolved: return true
+	case resolving:
+		if d.Cycle {
+			return false
+		}
+
+		d.Cycle = true
+		path   := []string{}
+		for i := len(c.resolving) - 1; i >= 0; i -- {
+			path = append([]string{c.resolving[i].Name.Value}, path...)
+			if c.resolving[i] == d {
+				break
+			}
+		}
+		path = append(path, n.Value)
+
+		goerror.Error(n.Token.Where, "Cyclic definition '%v'", strings.Join(path, " -> "))
+		goerror.Note(d.Token.Where, "'%v' defined here", n.Value)
+		return false
+	}
+
+	d.State     = resolving
+	c.resolving = append(c.resolving, d)
+
+	// Definitions are evaluated where they are in the memory, never inside of instructions
+	cursor, inInst, unreached := c.cursor, c.inInst, c.unreached
+	c.cursor, c.inInst, c.unreached = d.Cursor, false, nil
+	if !d.Reached {
+		c.unreached = d
+	}
+
+	switch n := d.Node.(type) {
+	case *node.Macro:   c.compileMacro(n)
+	case *node.Let:     c.compileLet(n, d)
+	case *node.Embed:   c.compileEmbed(n, d)
+	case *node.Reserve: c.compileReserve(n)
+	case *node.Table:   c.compileTable(n)
+	case *node.Struct:  c.compileStruct(n, d.Id)
+	case *node.Enum:
+		if d.Member != nil {
+			c.compileEnumMember(n, d.Member)
+		} else {
+			c.compileEnum(n)
+		}
+	}
+
+	c.cursor, c.inInst, c.unreached = cursor, inInst, unreached
+
+	c.resolving = c.resolving[:len(c.resolving) - 1]
+	d.State     = resolved
+	return true
+}
+
+// Marks the definitions of a statement as reached by the placement of data, returns the one
+// named by the statement or nil if there is none
+func (c *Compiler) reach(s node.Statement) *decl {
+	var name *node.Id
+	switch n := s.(type) {
+	case *node.Macro:   name = n.Name
+	case *node.Let:     name = n.Name
+	case *node.Embed:   name = n.Name
+	case *node.Reserve: name = n.Name
+	case *node.Table:   name = n.Name
+	case *node.Struct:  name = n.Name
+	case *node.Enum:
+		name = n.Name
+		for _, m := range n.Members {
+			if c.isMemberOf(n, m) {
+				member := c.decls[m.Name.Value]
+				member.Cursor, member.Reached = c.cursor, true
+			}
+		}
+
+	default: return nil
+	}
+
+	// Redefinitions have no definition of their own
+	d, ok := c.decls[name.Value]
+	if !ok || d.Node != s {
+		return nil
+	}
+
+	d.Cursor, d.Reached = c.cursor, true
+	return d
+}
+
+// Places the data of a definition, definitions without data are left to be resolved when used
+func (c *Compiler) placeData(d *decl) {
+	switch n := d.Node.(type) {
+	case *node.Let:     c.placeLet(n, d)
+	case *node.Embed:   c.placeEmbed(n, d)
+	case *node.Reserve: c.placeReserve(n)
+	case *node.Table:   c.placeTable(n)
+	}
+}
+
+func (c *Compiler) resolvedVar(name *node.Id) (Var, bool) {
+	if !c.resolve(name) {
+		return Var{}, false
+	}
+
+	var_, ok := c.vars[name.Value]
+	return var_, ok
+}
+
+// Enum members declared in the enum, skipping redefinitions
+func (c *Compiler) isMemberOf(e *node.Enum, m *node.EnumMember) bool {
+	d, ok := c.decls[m.Name.Value]
+	return ok && d.Node == e && d.Member == m
+}
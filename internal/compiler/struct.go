@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Struct type identifiers start after the builtin ones
+const structTypeIdStart = 0x100
+
+type Member struct {
+	Token  token.Token
+	Name   string
+	Type   *node.Type
+	Offset agen.Word
+}
+
+type Struct struct {
+	Token   token.Token
+	Id      agen.Word
+	Members []Member
+	Size    agen.Word
+	Align   agen.Word
+}
+
+func (s Struct) member(name string) (Member, bool) {
+	for _, member := range s.Members {
+		if member.Name == name {
+			return member, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// A scalar value inside of a type, structs are flattened into their members
+type slot struct {
+	Type   *node.Type
+	Offset agen.Word
+}
+
+func (c *Compiler) compileStruct(n *node.Struct, id agen.Word) {
+	s := Struct{Token: n.Token, Id: id, Align: 1}
+	if len(n.Members) == 0 {
+		goerror.Error(n.Name.Token.Where, "Struct '%v' has no members", n.Name.Value)
+	}
+
+	for _, m := range n.Members {
+		if prev, ok := s.member(m.Name.Value); ok {
+			goerror.Error(m.Name.Token.Where, "Member '%v' redefined", m.Name.Value)
+			goerror.Note(prev.Token.Where, "Previously defined here")
+			continue
+		}
+
+		if !c.validType(m.Type) {
+			continue
+		}
+
+		// Without 'align' the members are packed
+		if n.Aligned {
+			align := c.alignOfType(m.Type)
+			s.Size = alignUp(s.Size, align)
+			if align > s.Align {
+				s.Align = align
+			}
+		}
+
+		s.Members = append(s.Members, Member{
+			Token:  m.Token,
+			Name:   m.Name.Value,
+			Type:   m.Type,
+			Offset: s.Size,
+		})
+		s.Size += c.sizeOfType(m.Type)
+	}
+
+	s.Size = alignUp(s.Size, s.Align)
+	c.structs[n.Name.Value] = s
+}
+
+func (c *Compiler) validType(t *node.Type) bool {
+	if t.Struct == nil {
+		return true
+	}
+
+	if !c.resolve(t.Struct) {
+		return false
+	} else if _, ok := c.structs[t.Struct.Value]; !ok {
+		goerror.Error(t.Token.Where, "Undefined struct '%v'", t.Struct.Value)
+		return false
+	}
+
+	return true
+}
+
+func (c *Compiler) sizeOfType(t *node.Type) agen.Word {
+	if t.Struct == nil {
+		return typeSize(t.Type)
+	}
+
+	return c.structs[t.Struct.Value].Size
+}
+
+func (c *Compiler) alignOfType(t *node.Type) agen.Word {
+	if t.Struct == nil {
+		return typeSize(t.Type)
+	}
+
+	return c.structs[t.Struct.Value].Align
+}
+
+func (c *Compiler) slots(t *node.Type) (slots []slot) {
+	if t.Struct == nil {
+		return []slot{{Type: t}}
+	}
+
+	for _, member := range c.structs[t.Struct.Value].Members {
+		for _, s := range c.slots(member.Type) {
+			s.Offset += member.Offset
+			slots = append(slots, s)
+		}
+	}
+
+	return
+}
+
+func (c *Compiler) evalOffsetOf(n *node.OffsetOf) agen.Word {
+	if !c.resolve(n.Struct) {
+		return 0
+	}
+
+	s, ok := c.structs[n.Struct.Value]
+	if !ok {
+		goerror.Error(n.Struct.Token.Where, "Undefined struct '%v'", n.Struct.Value)
+		return 0
+	}
+
+	member, ok := s.member(n.Member.Value)
+	if !ok {
+		goerror.Error(n.Member.Token.Where, "Struct '%v' has no member '%v'",
+		              n.Struct.Value, n.Member.Value)
+		goerror.Note(s.Token.Where, "Declared here")
+		return 0
+	}
+
+	return member.Offset
+}
+
+func (c *Compiler) evalField(n *node.Field) agen.Word {
+	var_, ok := c.lookupVar(n.Id, "field")
+	if !ok {
+		return 0
+	}
+
+	if var_.Type.Struct == nil {
+		goerror.Error(n.Id.Token.Where, "Variable '%v' of type '%v' is not a struct",
+		              n.Id.Value, var_.Type)
+		return 0
+	}
+
+	s := c.structs[var_.Type.Struct.Value]
+	member, ok := s.member(n.Member.Value)
+	if !ok {
+		goerror.Error(n.Member.Token.Where, "Struct '%v' has no member '%v'",
+		              var_.Type.Struct.Value, n.Member.Value)
+		goerror.Note(s.Token.Where, "Declared here")
+		return 0
+	}
+
+	return c.addrOf(n.Id, var_) + member.Offset
+}
+
+func alignUp(value, align agen.Word) agen.Word {
+	if rem := value % align; rem != 0 {
+		return value + align - rem
+	}
+
+	return value
+}
@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+	"github.com/avm-collection/agen"
+
+	"github.com/avm-collection/anasm/internal/token"
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+const tableEntrySize = 8
+
+// Switches are lowered once all of the structured control flow is, so that tables inside of
+// blocks are known
+func (c *Compiler) lowerSwitches(list []node.Statement) (lowered []node.Statement) {
+	for _, s := range list {
+		if n, ok := s.(*node.Table); ok {
+			if _, ok := c.tables[n.Name.Value]; !ok {
+				c.tables[n.Name.Value] = n
+			}
+		}
+	}
+
+	for _, s := range list {
+		n, ok := s.(*node.Switch)
+		if !ok {
+			lowered = append(lowered, s)
+			continue
+		}
+
+		table, ok := c.tables[n.Table.Value]
+		if !ok {
+			goerror.Error(n.Table.Token.Where, "Undefined table '%v'", n.Table.Value)
+			continue
+		}
+
+		c.used[n.Table.Value] = true
+		lowered = append(lowered, c.lowerSwitch(n, table)...)
+	}
+
+	return
+}
+
+// The AVM can not jump to an address from the stack, so the index is bounds checked and then
+// dispatched with a binary search over the table, which takes log2 of the table size comparisons.
+// The search is generated from the labels of the table, its memory is only there for the program
+// to read.
+//   dup 0, psh COUNT, ule, jnz search, pop, jmp end, search: SEARCH, end:
+func (c *Compiler) lowerSwitch(n *node.Switch, table *node.Table) (lowered []node.Statement) {
+	labels := c.genLabels("switch", "search", "end")
+	search, end := labels[0], labels[1]
+
+	lowered = append(lowered, inst(n.Token, "dup", 0), inst(n.Token, "psh", len(table.Labels)),
+	                 inst(n.Token, "ule"), jumpTo(n.Token, "jnz", search))
+	lowered = append(lowered, inst(n.Token, "pop"), jumpTo(n.Token, "jmp", end))
+	lowered = append(lowered, at(search, n.Token))
+	lowered = append(lowered, c.lowerSearch(n, table, 0, len(table.Labels))...)
+
+	return append(lowered, at(end, n.Token))
+}
+
+// Searches the index in the entries from start until end, the index is known to be in there
+//   dup 0, psh MIDDLE, les, jnz below, SEARCH UPPER HALF, below: SEARCH LOWER HALF
+func (c *Compiler) lowerSearch(n *node.Switch, table *node.Table,
+                               start, end int) (lowered []node.Statement) {
+	if end - start == 1 {
+		label := table.Labels[start]
+		return append(lowered, inst(n.Token, "pop"), &node.Inst{
+			Token:     n.Token,
+			Name:      "jmp",
+			Arg:       &node.Id{Token: label.Token, Value: label.Value},
+			Generated: true,
+		})
+	}
+
+	below  := c.genLabels("switch", "below")[0]
+	middle := (start + end) / 2
+
+	lowered = append(lowered, inst(n.Token, "dup", 0), inst(n.Token, "psh", middle),
+	                 inst(n.Token, "les"), jumpTo(n.Token, "jnz", below))
+	lowered = append(lowered, c.lowerSearch(n, table, middle, end)...)
+	lowered = append(lowered, at(below, n.Token))
+	return append(lowered, c.lowerSearch(n, table, start, middle)...)
+}
+
+func inst(tok token.Token, name string, arg... int) *node.Inst {
+	n := &node.Inst{Token: tok, Name: name, Generated: true}
+	if len(arg) > 0 {
+		n.Arg = &node.Int{Token: tok, Value: int64(arg[0])}
+	}
+
+	return n
+}
+
+// Tables can only hold labels, which are all known once they are collected
+func (c *Compiler) checkTables() {
+	for _, s := range c.program.List {
+		n, ok := s.(*node.Table)
+		if !ok {
+			continue
+		}
+
+		for _, label := range n.Labels {
+			if _, ok := c.labels[label.Value]; !ok {
+				goerror.Error(label.Token.Where, "Expected a label in table '%v', got '%v'",
+				              n.Name.Value, label.Value)
+			}
+		}
+	}
+}
+
+func (c *Compiler) compileTable(n *node.Table) {
+	for _, label := range n.Labels {
+		c.used[label.Value] = true
+	}
+
+	tok := n.Token
+	tok.Type, tok.Data = token.TypeInt64, "i64"
+
+	c.vars[n.Name.Value] = Var{
+		Token: n.Token,
+		Type:  &node.Type{Token: tok, Type: agen.I64},
+		Count: agen.Word(len(n.Labels)),
+		Size:  agen.Word(len(n.Labels) * tableEntrySize),
+		Const: true,
+	}
+}
+
+// Tables are aligned for their i64 entries unless they are placed otherwise
+func (c *Compiler) placeTable(n *node.Table) {
+	var_, ok := c.resolvedVar(n.Name)
+	if !ok {
+		return
+	}
+
+	data := make([]byte, var_.Size)
+	for i, label := range n.Labels {
+		encode(data[i * tableEntrySize:], c.labels[label.Value].Addr, agen.I64)
+	}
+
+	attrs := n.Attrs
+	if attrs.Align == nil && attrs.Org == nil {
+		attrs.Align = &node.Int{Token: n.Token, Value: tableEntrySize}
+	}
+
+	var_.Addr, var_.Fixed = c.placeVar(n.Name, attrs, var_.Size)
+	var_.Placed = true
+	c.write(var_.Addr, data)
+	c.vars[n.Name.Value] = var_
+}
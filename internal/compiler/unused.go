@@ -0,0 +1,40 @@
+package compiler
+
+import (
+	"github.com/avm-collection/goerror"
+
+	"github.com/avm-collection/anasm/internal/node"
+)
+
+// Included files are libraries, most of which a program does not use, so their symbols are only
+// reported when asked for
+func (c *Compiler) WarnUnusedIncluded(warn bool) {
+	c.unusedInc = warn
+}
+
+// Labels, variables and macros which no expression refers to. The entry point is used by the
+// program starting there, enum members and command line definitions are not reported.
+func (c *Compiler) checkUnused() {
+	for _, s := range c.program.List {
+		switch n := s.(type) {
+		case *node.Label:
+			if !n.Generated && n.Name.Value != EntryLabel {
+				c.checkUsed(n.Name, "Label")
+			}
+
+		case *node.Let:     c.checkUsed(n.Name, "Variable")
+		case *node.Embed:   c.checkUsed(n.Name, "Variable")
+		case *node.Reserve: c.checkUsed(n.Name, "Variable")
+		case *node.Table:   c.checkUsed(n.Name, "Variable")
+		case *node.Macro:   c.checkUsed(n.Name, "Macro")
+		}
+	}
+}
+
+func (c *Compiler) checkUsed(name *node.Id, kind string) {
+	if c.used[name.Value] || name.Token.Where.Path != c.path && !c.unusedInc {
+		return
+	}
+
+	goerror.Warning(name.Token.Where, "%v '%v' is never used", kind, name.Value)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/avm-collection/agen"
 
 	"github.com/avm-collection/anasm/internal/compiler"
+	"github.com/avm-collection/anasm/internal/symbols"
 )
 
 type Disassembler struct {
@@ -22,6 +23,8 @@ type Disassembler struct {
 	memorySize  agen.Word
 	entryPoint  agen.Word
 
+	syms *symbols.Map
+
 	out string
 }
 
@@ -29,6 +32,11 @@ func New(input []byte, path string) *Disassembler {
 	return &Disassembler{input: input, path: path}
 }
 
+// Symbol information lets the disassembler name labels and values
+func (d *Disassembler) UseSymbols(syms *symbols.Map) {
+	d.syms = syms
+}
+
 func (d *Disassembler) readBytes(size int) ([]byte, error) {
 	var bytes []byte
 
@@ -99,11 +107,25 @@ func (d *Disassembler) writeInst(name string, data agen.Word, hasArgument bool)
 	d.out += "\t" + name
 
 	if hasArgument {
+		if d.syms != nil && (name == "jmp" || name == "jnz" || name == "cal") {
+			if labels := d.syms.LabelsAt(data); len(labels) > 0 {
+				d.out += " " + labels[0] + "\n"
+				return
+			}
+		}
+
 		// Argument as int
 		d.out += fmt.Sprintf(" %v", uint64(data))
 
 		// Argument as float (in a comment)
 		d.out += "\t\t# " + fmt.Sprintf("%v", math.Float64frombits(uint64(data)))
+
+		// Enum members with the same value
+		if d.syms != nil {
+			if names := d.syms.EnumsWith(data); len(names) > 0 {
+				d.out += ", " + strings.Join(names, " or ")
+			}
+		}
 	}
 
 	d.out += "\n"
@@ -158,13 +180,16 @@ func (d *Disassembler) Disassemble(path string) bool {
 }
 
 func (d *Disassembler) readMemory() {
-	if d.programSize == 0 || d.memorySize < 2 {
+	if d.programSize == 0 || d.memorySize == 0 {
 		return
 	}
 
-	d.out += "let MEM byte ="
-
 	_, _ = d.readBytes(1) // Skip the 0 byte
+	if d.memorySize < 2 {
+		return
+	}
+
+	d.out += "let MEM byte ="
 	for i := agen.Word(0); i < d.memorySize - 1; i ++ {
 		if i % 8 == 0 {
 			d.out += "\n\t"
@@ -192,7 +217,11 @@ func (d *Disassembler) readMemory() {
 func (d *Disassembler) readInsts() {
 	// Read and convert instructions
 	for i := agen.Word(0); i < d.programSize; i ++ {
-		if i == d.entryPoint {
+		if d.syms != nil {
+			for _, label := range d.syms.LabelsAt(i) {
+				d.out += "." + label + "\n"
+			}
+		} else if i == d.entryPoint {
 			d.out += ".entry\n"
 		}
 
@@ -19,18 +19,56 @@ type Lexer struct {
 }
 
 var Keywords = map[string]token.Type{
-	"let": token.Let,
-	"mac": token.Macro,
-	"emb": token.Embed,
+	"let":   token.Let,
+	"const": token.Const,
+	"mac":   token.Macro,
+	"emb":   token.Embed,
+	"res":   token.Reserve,
+
+	"struct": token.Struct,
+	"align":  token.Align,
+	"org":    token.Org,
+	"end":    token.End,
+
+	"enum":  token.Enum,
+	"flags": token.Flags,
+
+	"if":    token.If,
+	"else":  token.Else,
+	"while": token.While,
+	"do":    token.Do,
+	"loop":  token.Loop,
+	"break": token.Break,
+
+	"table":  token.Table,
+	"switch": token.Switch,
+
+	"proc": token.Proc,
+	"endp": token.EndProc,
+	"--":   token.Dashes,
+
+	"$":  token.Here,
+	"$$": token.Cursor,
+
+	"assert":  token.Assert,
+	"error":   token.UserError,
+	"warning": token.UserWarning,
 
 	"byte": token.TypeByte,
 	"char": token.TypeChar,
 	"i16":  token.TypeInt16,
 	"i32":  token.TypeInt32,
 	"i64":  token.TypeInt64,
+	"f32":  token.TypeFloat32,
 	"f64":  token.TypeFloat64,
 
-	"sizeof": token.SizeOf,
+	"sizeof":   token.SizeOf,
+	"countof":  token.CountOf,
+	"elemsize": token.ElemSize,
+	"typeof":   token.TypeOf,
+	"at":       token.At,
+	"offsetof": token.OffsetOf,
+	"field":    token.Field,
 
 	"+": token.Add,
 	"-": token.Sub,
@@ -44,6 +82,11 @@ var Keywords = map[string]token.Type{
 	">>": token.BitSRight,
 	"<<": token.BitSLeft,
 
+	">":  token.Greater,
+	">=": token.GreaterEq,
+	"<":  token.Less,
+	"<=": token.LessEq,
+
 	"include": token.Include,
 }
 
@@ -140,7 +183,23 @@ func (l *Lexer) NextToken() (tok token.Token) {
 			l.next()
 
 		case '=':
-			tok = token.Token{Type: token.Equals, Data: string(l.ch)}
+			if l.peek() == '=' {
+				l.next()
+
+				tok = token.Token{Type: token.Eq, Data: "=="}
+			} else {
+				tok = token.Token{Type: token.Equals, Data: string(l.ch)}
+			}
+			l.next()
+
+		case '!':
+			if l.peek() != '=' {
+				l.where.Len = 1
+				return token.NewError(l.where, "Unexpected character '%v'", string(l.ch))
+			}
+			l.next()
+
+			tok = token.Token{Type: token.NotEq, Data: "!="}
 			l.next()
 
 		default:
@@ -374,6 +433,12 @@ func (l *Lexer) lexLabel() token.Token {
 
 func (l *Lexer) lexId() token.Token {
 	str := l.readId()
+	if (str == "<" || str == ">") && l.ch == '=' {
+		str += string(l.ch)
+
+		l.next()
+	}
+
 	type_, ok := Keywords[str]
 	if ok {
 		return token.Token{Type: type_, Data: str}
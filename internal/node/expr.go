@@ -51,7 +51,9 @@ func (n *Id) String()   string      {return n.Value}
 type Type struct {
 	Token token.Token
 
-	Type agen.Type
+	Type   agen.Type
+	Float  bool
+	Struct *Id
 }
 
 func (n *Type) expr() {}
@@ -80,20 +82,102 @@ func (n *BinOp) String()   (s string) {
 type SizeOf struct {
 	Token token.Token
 
-	Id   *Id
-	Type *Type
+	Id      *Id
+	Type    *Type
+	Literal Expr
 }
 
 func (n *SizeOf) expr() {}
 func (n *SizeOf) GetToken() token.Token {return n.Token}
 func (n *SizeOf) String()   string {
-	if n.Id == nil {
+	if n.Id != nil {
+		return fmt.Sprintf("(sizeof %v)", n.Id)
+	} else if n.Literal != nil {
+		return fmt.Sprintf("(sizeof %v)", n.Literal)
+	} else {
 		return fmt.Sprintf("(sizeof %v)", n.Type)
+	}
+}
+
+type CountOf struct {
+	Token token.Token
+
+	Id *Id
+}
+
+func (n *CountOf) expr() {}
+func (n *CountOf) GetToken() token.Token {return n.Token}
+func (n *CountOf) String()   string      {return fmt.Sprintf("(countof %v)", n.Id)}
+
+type ElemSize struct {
+	Token token.Token
+
+	Id   *Id
+	Type *Type
+}
+
+func (n *ElemSize) expr() {}
+func (n *ElemSize) GetToken() token.Token {return n.Token}
+func (n *ElemSize) String()   string {
+	if n.Id == nil {
+		return fmt.Sprintf("(elemsize %v)", n.Type)
 	} else {
-		return fmt.Sprintf("(sizeof %v)", n.Id)
+		return fmt.Sprintf("(elemsize %v)", n.Id)
+	}
+}
+
+type TypeOf struct {
+	Token token.Token
+
+	Id   *Id
+	Type *Type
+}
+
+func (n *TypeOf) expr() {}
+func (n *TypeOf) GetToken() token.Token {return n.Token}
+func (n *TypeOf) String()   string {
+	if n.Id == nil {
+		return fmt.Sprintf("(typeof %v)", n.Type)
+	} else {
+		return fmt.Sprintf("(typeof %v)", n.Id)
 	}
 }
 
+type At struct {
+	Token token.Token
+
+	Id    *Id
+	Index Expr
+}
+
+func (n *At) expr() {}
+func (n *At) GetToken() token.Token {return n.Token}
+func (n *At) String()   string      {return fmt.Sprintf("(at %v %v)", n.Id, n.Index)}
+
+type OffsetOf struct {
+	Token token.Token
+
+	Struct *Id
+	Member *Id
+}
+
+func (n *OffsetOf) expr() {}
+func (n *OffsetOf) GetToken() token.Token {return n.Token}
+func (n *OffsetOf) String()   string {
+	return fmt.Sprintf("(offsetof %v %v)", n.Struct, n.Member)
+}
+
+type Field struct {
+	Token token.Token
+
+	Id     *Id
+	Member *Id
+}
+
+func (n *Field) expr() {}
+func (n *Field) GetToken() token.Token {return n.Token}
+func (n *Field) String()   string      {return fmt.Sprintf("(field %v %v)", n.Id, n.Member)}
+
 type Fill struct {
 	Token token.Token
 
@@ -106,3 +190,54 @@ func (n *Fill) GetToken() token.Token {return n.Token}
 func (n *Fill) String()   string {
 	return fmt.Sprintf("(.. %v %v)", n.Value, n.Count)
 }
+
+type Cast struct {
+	Token token.Token
+
+	Type  *Type
+	Value Expr
+}
+
+func (n *Cast) expr() {}
+func (n *Cast) GetToken() token.Token {return n.Token}
+func (n *Cast) String()   string {
+	return fmt.Sprintf("(%v %v)", n.Type, n.Value)
+}
+
+// Anonymous read-only data, evaluates to its address
+type Array struct {
+	Token token.Token
+
+	Type   *Type
+	Values []Expr
+}
+
+func (n *Array) expr() {}
+func (n *Array) GetToken() token.Token {return n.Token}
+func (n *Array) String()   (s string) {
+	s += fmt.Sprintf("(const %v", n.Type)
+	for _, val := range n.Values {
+		s += fmt.Sprintf(" %v", val)
+	}
+	s += ")"
+
+	return
+}
+
+// Address of the current instruction
+type Here struct {
+	Token token.Token
+}
+
+func (n *Here) expr() {}
+func (n *Here) GetToken() token.Token {return n.Token}
+func (n *Here) String()   string      {return "$"}
+
+// Where the next variable is placed in the memory
+type Cursor struct {
+	Token token.Token
+}
+
+func (n *Cursor) expr() {}
+func (n *Cursor) GetToken() token.Token {return n.Token}
+func (n *Cursor) String()   string      {return "$$"}
@@ -25,8 +25,9 @@ func (n *Statements) String()   (s string) {
 type Inst struct {
 	Token token.Token
 
-	Name string
-	Arg  Expr
+	Name      string
+	Arg       Expr
+	Generated bool // Generated by the compiler for control flow
 }
 
 func (n *Inst) statement() {}
@@ -42,23 +43,50 @@ func (n *Inst) String()   string {
 type Label struct {
 	Token token.Token
 
-	Name *Id
+	Name      *Id
+	Generated bool // Generated by the compiler for control flow
 }
 
 func (n *Label) statement() {}
 func (n *Label) GetToken() token.Token {return n.Token}
 func (n *Label) String()   string      {return fmt.Sprintf("(label %v)", n.Name)}
 
+// Placement attributes of variables
+type Attrs struct {
+	Align Expr
+	Org   Expr
+}
+
+func (a Attrs) String() (s string) {
+	if a.Align != nil {
+		s += fmt.Sprintf(" (align %v)", a.Align)
+	}
+
+	if a.Org != nil {
+		s += fmt.Sprintf(" (org %v)", a.Org)
+	}
+
+	return
+}
+
 type Embed struct {
 	Token token.Token
+	Attrs
 
-	Name *Id
-	Path *String
+	Name  *Id
+	Path  *String
+	Const bool // Read-only
 }
 
 func (n *Embed) statement() {}
 func (n *Embed) GetToken() token.Token {return n.Token}
-func (n *Embed) String()   string      {return fmt.Sprintf("(embed %v %v)", n.Name, n.Path)}
+func (n *Embed) String()   string {
+	if n.Const {
+		return fmt.Sprintf("(const embed %v%v %v)", n.Name, n.Attrs, n.Path)
+	}
+
+	return fmt.Sprintf("(embed %v%v %v)", n.Name, n.Attrs, n.Path)
+}
 
 type Macro struct {
 	Token token.Token
@@ -73,16 +101,23 @@ func (n *Macro) String()   string      {return fmt.Sprintf("(macro %v %v)", n.Na
 
 type Let struct {
 	Token token.Token
+	Attrs
 
 	Name  *Id
 	Type  *Type
+	Const bool // Read-only
 	Values []Expr
 }
 
 func (n *Let) statement() {}
 func (n *Let) GetToken() token.Token {return n.Token}
 func (n *Let) String()   (s string) {
-	s += fmt.Sprintf("(let %v %v", n.Name, n.Type)
+	keyword := "let"
+	if n.Const {
+		keyword = "const"
+	}
+
+	s += fmt.Sprintf("(%v %v%v %v", keyword, n.Name, n.Attrs, n.Type)
 	for _, val := range n.Values {
 		s += fmt.Sprintf(" %v", val)
 	}
@@ -90,3 +125,255 @@ func (n *Let) String()   (s string) {
 
 	return
 }
+
+type Member struct {
+	Token token.Token
+
+	Name *Id
+	Type *Type
+}
+
+func (n *Member) GetToken() token.Token {return n.Token}
+func (n *Member) String()   string      {return fmt.Sprintf("(%v %v)", n.Name, n.Type)}
+
+type Struct struct {
+	Token token.Token
+
+	Name    *Id
+	Aligned bool
+	Members []*Member
+}
+
+func (n *Struct) statement() {}
+func (n *Struct) GetToken() token.Token {return n.Token}
+func (n *Struct) String()   (s string) {
+	s += fmt.Sprintf("(struct %v", n.Name)
+	if n.Aligned {
+		s += " align"
+	}
+
+	for _, member := range n.Members {
+		s += fmt.Sprintf(" %v", member)
+	}
+	s += ")"
+
+	return
+}
+
+type EnumMember struct {
+	Token token.Token
+
+	Name  *Id
+	Value Expr
+}
+
+func (n *EnumMember) GetToken() token.Token {return n.Token}
+func (n *EnumMember) String()   string {
+	if n.Value == nil {
+		return n.Name.String()
+	} else {
+		return fmt.Sprintf("(%v %v)", n.Name, n.Value)
+	}
+}
+
+type Enum struct {
+	Token token.Token
+
+	Name    *Id
+	Flags   bool
+	Members []*EnumMember
+}
+
+func (n *Enum) statement() {}
+func (n *Enum) GetToken() token.Token {return n.Token}
+func (n *Enum) String()   (s string) {
+	s += fmt.Sprintf("(enum %v", n.Name)
+	if n.Flags {
+		s += " flags"
+	}
+
+	for _, member := range n.Members {
+		s += fmt.Sprintf(" %v", member)
+	}
+	s += ")"
+
+	return
+}
+
+type Align struct {
+	Token token.Token
+
+	Value Expr
+}
+
+func (n *Align) statement() {}
+func (n *Align) GetToken() token.Token {return n.Token}
+func (n *Align) String()   string      {return fmt.Sprintf("(align %v)", n.Value)}
+
+type Reserve struct {
+	Token token.Token
+	Attrs
+
+	Name *Id
+	Size Expr
+}
+
+func (n *Reserve) statement() {}
+func (n *Reserve) GetToken() token.Token {return n.Token}
+func (n *Reserve) String()   string {
+	return fmt.Sprintf("(res %v%v %v)", n.Name, n.Attrs, n.Size)
+}
+
+// Addresses of labels stored as i64 values
+type Table struct {
+	Token token.Token
+	Attrs
+
+	Name   *Id
+	Labels []*Id
+}
+
+func (n *Table) statement() {}
+func (n *Table) GetToken() token.Token {return n.Token}
+func (n *Table) String()   (s string) {
+	s += fmt.Sprintf("(table %v%v", n.Name, n.Attrs)
+	for _, label := range n.Labels {
+		s += fmt.Sprintf(" %v", label)
+	}
+	s += ")"
+
+	return
+}
+
+type Assert struct {
+	Token token.Token
+
+	Cond    Expr
+	Message *String
+}
+
+func (n *Assert) statement() {}
+func (n *Assert) GetToken() token.Token {return n.Token}
+func (n *Assert) String()   string {
+	return fmt.Sprintf("(assert %v %v)", n.Cond, n.Message)
+}
+
+// User defined errors and warnings, the condition is optional
+type Report struct {
+	Token token.Token
+
+	Cond    Expr
+	Message *String
+}
+
+func (n *Report) statement() {}
+func (n *Report) GetToken() token.Token {return n.Token}
+func (n *Report) String()   string {
+	if n.Cond == nil {
+		return fmt.Sprintf("(%v %v)", n.Token.Type, n.Message)
+	}
+
+	return fmt.Sprintf("(%v %v %v)", n.Token.Type, n.Cond, n.Message)
+}
+
+func blockString(list []Statement) (s string) {
+	s += "("
+	for i, statement := range list {
+		if i > 0 {
+			s += " "
+		}
+
+		s += statement.String()
+	}
+	s += ")"
+
+	return
+}
+
+// Pops a condition, runs the then block if it is not zero and the else block otherwise
+type If struct {
+	Token     token.Token
+	ElseToken token.Token
+	EndToken  token.Token
+
+	Then, Else []Statement
+}
+
+func (n *If) statement() {}
+func (n *If) GetToken() token.Token {return n.Token}
+func (n *If) String()   string {
+	return fmt.Sprintf("(if %v %v)", blockString(n.Then), blockString(n.Else))
+}
+
+// Runs the condition block and then the body while the condition leaves a non-zero value
+type While struct {
+	Token    token.Token
+	DoToken  token.Token
+	EndToken token.Token
+
+	Cond, Body []Statement
+}
+
+func (n *While) statement() {}
+func (n *While) GetToken() token.Token {return n.Token}
+func (n *While) String()   string {
+	return fmt.Sprintf("(while %v %v)", blockString(n.Cond), blockString(n.Body))
+}
+
+// Runs the body until a break
+type Loop struct {
+	Token    token.Token
+	EndToken token.Token
+
+	Body []Statement
+}
+
+func (n *Loop) statement() {}
+func (n *Loop) GetToken() token.Token {return n.Token}
+func (n *Loop) String()   string      {return fmt.Sprintf("(loop %v)", blockString(n.Body))}
+
+type Break struct {
+	Token token.Token
+}
+
+func (n *Break) statement() {}
+func (n *Break) GetToken() token.Token {return n.Token}
+func (n *Break) String()   string      {return "(break)"}
+
+// Pops an index and jumps to the label at that index in the table, out of bounds indexes continue
+// after the switch
+type Switch struct {
+	Token token.Token
+
+	Table *Id
+}
+
+func (n *Switch) statement() {}
+func (n *Switch) GetToken() token.Token {return n.Token}
+func (n *Switch) String()   string      {return fmt.Sprintf("(switch %v)", n.Table)}
+
+// A label with a declared stack signature, its inputs are taken from the stack and replaced with
+// its outputs. The names only document the values.
+type Proc struct {
+	Token    token.Token
+	EndToken token.Token
+
+	Name            *Id
+	Inputs, Outputs []*Id
+	Body            []Statement
+}
+
+func (n *Proc) statement() {}
+func (n *Proc) GetToken() token.Token {return n.Token}
+func (n *Proc) String()   (s string) {
+	s += fmt.Sprintf("(proc %v (", n.Name)
+	for _, input := range n.Inputs {
+		s += fmt.Sprintf("%v ", input)
+	}
+	s += "--"
+	for _, output := range n.Outputs {
+		s += fmt.Sprintf(" %v", output)
+	}
+
+	return s + fmt.Sprintf(") %v)", blockString(n.Body))
+}
@@ -15,6 +15,8 @@ import (
 
 type Parser struct {
 	statements *node.Statements
+	loops      int  // Depth of loops around the current statement
+	inProc     bool
 
 	tok token.Token
 	l  *lexer.Lexer
@@ -55,15 +57,58 @@ func (p *Parser) parseFile(input, path string) {
 		os.Exit(1)
 	}
 
+	p.parseBlock()
+
+	p.l   = prevLexer
+	p.tok = prevTok
+}
+
+// Parses statements into the current list until the end of the file or one of the terminators
+func (p *Parser) parseBlock(ends... token.Type) {
 	for p.tok.Type != token.EOF {
 		var s node.Statement
 
+		for _, end := range ends {
+			if p.tok.Type == end {
+				return
+			}
+		}
+
 		switch p.tok.Type {
-		case token.Id:    s = p.parseInst()
-		case token.Label: s = p.parseLabel()
-		case token.Let:   s = p.parseLet()
-		case token.Embed: s = p.parseEmbed()
-		case token.Macro: s = p.parseMacro()
+		case token.Id:
+			// Pseudo instruction pushing an address and the size of the memory there
+			if p.tok.Data == "psl" {
+				p.statements.List = append(p.statements.List, p.parsePushWithSize()...)
+				continue
+			}
+
+			s = p.parseInst()
+
+		case token.Label:   s = p.parseLabel()
+		case token.Let, token.Const: s = p.parseLet()
+		case token.Embed:   s = p.parseEmbed()
+		case token.Reserve: s = p.parseReserve()
+		case token.Macro:   s = p.parseMacro()
+		case token.Struct:  s = p.parseStruct()
+		case token.Enum:    s = p.parseEnum()
+		case token.Table:   s = p.parseTable()
+		case token.Align:   s = p.parseAlign()
+		case token.Assert:  s = p.parseAssert()
+
+		case token.UserError, token.UserWarning: s = p.parseReport()
+
+		case token.If:    s = p.parseIf()
+		case token.While: s = p.parseWhile()
+		case token.Loop:  s = p.parseLoop()
+		case token.Break: s = p.parseBreak()
+
+		case token.Switch: s = p.parseSwitch()
+		case token.Proc:   s = p.parseProc()
+
+		case token.Else, token.Do, token.End, token.EndProc:
+			goerror.Error(p.tok.Where, "Unexpected %v outside of a block", p.tok)
+			p.next()
+			continue
 
 		case token.Include:
 			p.evalInclude()
@@ -74,9 +119,129 @@ func (p *Parser) parseFile(input, path string) {
 
 		p.statements.List = append(p.statements.List, s)
 	}
+}
 
-	p.l   = prevLexer
-	p.tok = prevTok
+// Parses the statements of a block into their own list
+func (p *Parser) parseBody(start token.Token, ends... token.Type) []node.Statement {
+	prev := p.statements.List
+	p.statements.List = nil
+
+	p.parseBlock(ends...)
+	if p.tok.Type == token.EOF {
+		goerror.Error(p.tok.Where, "Expected %v, got %v", ends[len(ends) - 1], p.tok)
+		goerror.Note(start.Where, "Opened here")
+	}
+
+	body := p.statements.List
+	p.statements.List = prev
+	return body
+}
+
+func (p *Parser) parseIf() *node.If {
+	n := &node.If{Token: p.tok}
+	p.next()
+
+	n.Then = p.parseBody(n.Token, token.Else, token.End)
+	if p.tok.Type == token.Else {
+		n.ElseToken = p.tok
+		p.next()
+
+		n.Else = p.parseBody(n.Token, token.End)
+	}
+
+	n.EndToken = p.tok
+	p.next()
+	return n
+}
+
+func (p *Parser) parseWhile() *node.While {
+	n := &node.While{Token: p.tok}
+	p.next()
+
+	n.Cond    = p.parseBody(n.Token, token.Do)
+	n.DoToken = p.tok
+	p.next()
+
+	p.loops ++
+	n.Body = p.parseBody(n.Token, token.End)
+	p.loops --
+
+	n.EndToken = p.tok
+	p.next()
+	return n
+}
+
+func (p *Parser) parseLoop() *node.Loop {
+	n := &node.Loop{Token: p.tok}
+	p.next()
+
+	p.loops ++
+	n.Body = p.parseBody(n.Token, token.End)
+	p.loops --
+
+	n.EndToken = p.tok
+	p.next()
+	return n
+}
+
+func (p *Parser) parseBreak() *node.Break {
+	n := &node.Break{Token: p.tok}
+	if p.loops == 0 {
+		goerror.Error(p.tok.Where, "Unexpected %v outside of a loop", p.tok)
+	}
+
+	p.next()
+	return n
+}
+
+//   proc NAME (INPUTS... -- OUTPUTS...) BODY endp
+func (p *Parser) parseProc() *node.Proc {
+	n := &node.Proc{Token: p.tok}
+	if p.inProc {
+		goerror.Error(p.tok.Where, "Unexpected %v inside of a procedure", p.tok)
+	}
+	p.next()
+
+	n.Name = p.parseId()
+	if p.tok.Type != token.LParen {
+		goerror.Error(p.tok.Where, "Expected stack signature '(... %v ...)', got %v",
+		              token.Dashes, p.tok)
+		return nil
+	}
+	p.next()
+
+	var ok bool
+	if n.Inputs, ok = p.parseSignature(token.Dashes); !ok {
+		return nil
+	} else if n.Outputs, ok = p.parseSignature(token.RParen); !ok {
+		return nil
+	}
+
+	// Loops around the procedure can not be broken out of from inside
+	loops := p.loops
+	p.loops, p.inProc = 0, true
+	n.Body = p.parseBody(n.Token, token.EndProc)
+	p.loops, p.inProc = loops, false
+
+	n.EndToken = p.tok
+	p.next()
+	return n
+}
+
+func (p *Parser) parseSignature(end token.Type) (names []*node.Id, ok bool) {
+	for p.tok.Type != end {
+		if p.tok.Type == token.EOF || p.tok.Type == token.RParen {
+			goerror.Error(p.tok.Where, "Expected '%v' in stack signature, got %v", end, p.tok)
+			return nil, false
+		}
+
+		if name := p.parseId(); name != nil {
+			names = append(names, name)
+		}
+	}
+	p.next()
+
+	return names, true
 }
 
 func (p *Parser) evalInclude() {
@@ -119,11 +284,19 @@ func (p *Parser) parseMacro() *node.Macro {
 }
 
 func (p *Parser) parseLet() node.Statement {
-	n := &node.Let{Token: p.tok}
+	n := &node.Let{Token: p.tok, Const: p.tok.Type == token.Const}
 	p.next()
 
-	n.Name = p.parseId()
-	n.Type = p.parseType()
+	// Read-only embedded files
+	if n.Const && p.tok.Type == token.Embed {
+		embed := p.parseEmbed()
+		embed.Const = true
+		return embed
+	}
+
+	n.Name  = p.parseId()
+	n.Attrs = p.parseAttrs()
+	n.Type  = p.parseType()
 
 	if p.tok.Type != token.Equals {
 		goerror.Error(p.tok.Where, "Expected assignment with '%v' or size with '%v', got %v",
@@ -158,15 +331,168 @@ func (p *Parser) parseLet() node.Statement {
 	return n
 }
 
+func (p *Parser) parseStruct() *node.Struct {
+	n := &node.Struct{Token: p.tok}
+	p.next()
+
+	n.Name = p.parseId()
+	if p.tok.Type == token.Align {
+		n.Aligned = true
+		p.next()
+	}
+
+	for p.tok.Type != token.End {
+		if p.tok.Type == token.EOF {
+			goerror.Error(p.tok.Where, "Expected '%v', got %v", token.End, p.tok)
+			goerror.Note(n.Token.Where, "Struct started here")
+			return nil
+		}
+
+		member := &node.Member{Token: p.tok}
+		member.Name = p.parseId()
+		member.Type = p.parseType()
+
+		n.Members = append(n.Members, member)
+	}
+	p.next()
+
+	return n
+}
+
+func (p *Parser) parseEnum() *node.Enum {
+	n := &node.Enum{Token: p.tok}
+	p.next()
+
+	n.Name = p.parseId()
+	if p.tok.Type == token.Flags {
+		n.Flags = true
+		p.next()
+	}
+
+	for p.tok.Type != token.End {
+		if p.tok.Type == token.EOF {
+			goerror.Error(p.tok.Where, "Expected '%v', got %v", token.End, p.tok)
+			goerror.Note(n.Token.Where, "Enum started here")
+			return nil
+		}
+
+		member := &node.EnumMember{Token: p.tok}
+		member.Name = p.parseId()
+		if p.tok.Type == token.Equals {
+			p.next()
+			member.Value = p.parseExpr()
+		}
+
+		n.Members = append(n.Members, member)
+	}
+	p.next()
+
+	return n
+}
+
 func (p *Parser) parseEmbed() *node.Embed {
 	n := &node.Embed{Token: p.tok}
 	p.next()
 
-	n.Name = p.parseId()
-	n.Path = p.parseString()
+	n.Name  = p.parseId()
+	n.Attrs = p.parseAttrs()
+	n.Path  = p.parseString()
+	return n
+}
+
+func (p *Parser) parseReserve() *node.Reserve {
+	n := &node.Reserve{Token: p.tok}
+	p.next()
+
+	n.Name  = p.parseId()
+	n.Attrs = p.parseAttrs()
+	n.Size  = p.parseExpr()
 	return n
 }
 
+func (p *Parser) parseTable() *node.Table {
+	n := &node.Table{Token: p.tok}
+	p.next()
+
+	n.Name  = p.parseId()
+	n.Attrs = p.parseAttrs()
+
+	if p.tok.Type != token.Equals {
+		goerror.Error(p.tok.Where, "Expected assignment with '%v', got %v", token.Equals, p.tok)
+		p.next()
+		return nil
+	}
+
+	p.next()
+
+	for {
+		if label := p.parseId(); label != nil {
+			n.Labels = append(n.Labels, label)
+		}
+
+		if p.tok.Type != token.Comma {
+			break
+		} else {
+			p.next()
+		}
+	}
+
+	return n
+}
+
+func (p *Parser) parseSwitch() *node.Switch {
+	n := &node.Switch{Token: p.tok}
+	p.next()
+
+	n.Table = p.parseId()
+	return n
+}
+
+func (p *Parser) parseAlign() *node.Align {
+	n := &node.Align{Token: p.tok}
+	p.next()
+
+	n.Value = p.parseExpr()
+	return n
+}
+
+func (p *Parser) parseAssert() *node.Assert {
+	n := &node.Assert{Token: p.tok}
+	p.next()
+
+	n.Cond    = p.parseExpr()
+	n.Message = p.parseString()
+	return n
+}
+
+func (p *Parser) parseReport() *node.Report {
+	n := &node.Report{Token: p.tok}
+	p.next()
+
+	if p.tok.Type != token.String {
+		n.Cond = p.parseExpr()
+	}
+
+	n.Message = p.parseString()
+	return n
+}
+
+func (p *Parser) parseAttrs() (attrs node.Attrs) {
+	for {
+		switch p.tok.Type {
+		case token.Align:
+			p.next()
+			attrs.Align = p.parseExpr()
+
+		case token.Org:
+			p.next()
+			attrs.Org = p.parseExpr()
+
+		default: return
+		}
+	}
+}
+
 func (p *Parser) parseLabel() *node.Label {
 	n := &node.Label{Token: p.tok}
 
@@ -192,6 +518,32 @@ func (p *Parser) parseInst() *node.Inst {
 	return n
 }
 
+func (p *Parser) parsePushWithSize() []node.Statement {
+	tok := p.tok
+	p.next()
+
+	addr := p.parseExpr()
+	if addr == nil {
+		return nil
+	}
+
+	size := &node.SizeOf{Token: addr.GetToken()}
+	switch n := addr.(type) {
+	case *node.Id:                  size.Id      = n
+	case *node.String, *node.Array: size.Literal = n
+
+	default:
+		goerror.Error(addr.GetToken().Where, "Expected an identifier or a literal, got %v",
+		              addr.GetToken())
+		return nil
+	}
+
+	return []node.Statement{
+		&node.Inst{Token: tok, Name: "psh", Arg: addr},
+		&node.Inst{Token: tok, Name: "psh", Arg: size},
+	}
+}
+
 func (p *Parser) parseExpr() node.Expr {
 	switch p.tok.Type {
 	case token.Id:     return p.parseId()
@@ -199,11 +551,23 @@ func (p *Parser) parseExpr() node.Expr {
 	case token.String: return p.parseString()
 	case token.Float:  return p.parseFloat()
 
+	case token.Here:
+		n := &node.Here{Token: p.tok}
+		p.next()
+		return n
+
+	case token.Cursor:
+		n := &node.Cursor{Token: p.tok}
+		p.next()
+		return n
+
 	default:
 		if p.tok.Type.IsInt() {
 			return p.parseInt()
 		} else if p.tok.Type.IsType() {
 			return p.parseType()
+		} else if p.tok.Type.IsKeyword() {
+			return p.parseId()
 		} else {
 			goerror.Error(p.tok.Where, "Unexpected %v in expression", p.tok)
 			p.next()
@@ -215,7 +579,9 @@ func (p *Parser) parseExpr() node.Expr {
 func (p *Parser) parseId() *node.Id {
 	n := &node.Id{Token: p.tok}
 
-	if p.tok.Type != token.Id {
+	if p.tok.Type.IsKeyword() {
+		n.Token.Type = token.Id
+	} else if p.tok.Type != token.Id {
 		goerror.Error(p.tok.Where, "Expected identifier, got %v", p.tok)
 		p.next()
 		return nil
@@ -284,13 +650,17 @@ func (p *Parser) parseType() *node.Type {
 	n := &node.Type{Token: p.tok}
 
 	switch p.tok.Type {
-	case token.TypeByte, token.TypeChar:     n.Type = agen.I8
-	case token.TypeInt16:                    n.Type = agen.I16
-	case token.TypeInt32:                    n.Type = agen.I32
-	case token.TypeInt64, token.TypeFloat64: n.Type = agen.I64
+	case token.TypeByte, token.TypeChar: n.Type = agen.I8
+	case token.TypeInt16:                n.Type = agen.I16
+	case token.TypeInt32:                n.Type = agen.I32
+	case token.TypeInt64:                n.Type = agen.I64
+	case token.TypeFloat32:              n.Type, n.Float = agen.I32, true
+	case token.TypeFloat64:              n.Type, n.Float = agen.I64, true
+	case token.Id:                       n.Struct = &node.Id{Token: p.tok, Value: p.tok.Data}
 
 	default:
-		goerror.Error(p.tok.Where, "Expected a type (byte/char/i16/i32/i64/f164), got %v", p.tok)
+		goerror.Error(p.tok.Where, "Expected a type (byte/char/i16/i32/i64/f32/f64/struct), got %v",
+		              p.tok)
 		p.next()
 		return nil
 	}
@@ -303,8 +673,18 @@ func (p *Parser) parseFunc() node.Expr {
 	start := p.tok
 	p.next()
 
-	if p.tok.Type == token.SizeOf {
-		return p.parseSizeOf(start)
+	if p.tok.Type.IsQuery() {
+		return p.parseQuery(start)
+	} else if p.tok.Type == token.At {
+		return p.parseAt(start)
+	} else if p.tok.Type == token.OffsetOf {
+		return p.parseOffsetOf(start)
+	} else if p.tok.Type == token.Field {
+		return p.parseField(start)
+	} else if p.tok.Type == token.Const {
+		return p.parseArray(start)
+	} else if p.tok.Type.IsType() {
+		return p.parseCast(start)
 	} else if p.tok.Type.IsBinOp() {
 		return p.parseBinOp(start)
 	} else {
@@ -314,16 +694,32 @@ func (p *Parser) parseFunc() node.Expr {
 	}
 }
 
-func (p *Parser) parseSizeOf(start token.Token) *node.SizeOf {
-	n := &node.SizeOf{Token: start}
-
+func (p *Parser) parseQuery(start token.Token) node.Expr {
+	func_ := p.tok.Type
 	p.next()
+
+	var (
+		id      *node.Id
+		type_   *node.Type
+		literal node.Expr
+	)
 	if p.tok.Type == token.Id {
-		n.Id = p.parseId()
-	} else if p.tok.Type.IsType() {
-		n.Type = p.parseType()
+		id = p.parseId()
+	} else if p.tok.Type.IsType() && func_ != token.CountOf {
+		type_ = p.parseType()
+	} else if (p.tok.Type == token.String || p.tok.Type == token.LParen) && func_ == token.SizeOf {
+		if literal = p.parseExpr(); literal == nil {
+			return nil
+		} else if !isLiteral(literal) {
+			goerror.Error(literal.GetToken().Where, "Expected a literal, got %v", literal.GetToken())
+			return nil
+		}
 	} else {
-		goerror.Error(p.tok.Where, "Expected an identifier or a type, got %v", p.tok)
+		if func_ == token.CountOf {
+			goerror.Error(p.tok.Where, "Expected an identifier, got %v", p.tok)
+		} else {
+			goerror.Error(p.tok.Where, "Expected an identifier or a type, got %v", p.tok)
+		}
 		p.next()
 		return nil
 	}
@@ -335,6 +731,118 @@ func (p *Parser) parseSizeOf(start token.Token) *node.SizeOf {
 	}
 	p.next()
 
+	switch func_ {
+	case token.SizeOf:   return &node.SizeOf{Token: start, Id: id, Type: type_, Literal: literal}
+	case token.CountOf:  return &node.CountOf{Token: start, Id: id}
+	case token.ElemSize: return &node.ElemSize{Token: start, Id: id, Type: type_}
+	case token.TypeOf:   return &node.TypeOf{Token: start, Id: id, Type: type_}
+
+	default: panic("Unreachable")
+	}
+}
+
+func isLiteral(n node.Expr) bool {
+	switch n.(type) {
+	case *node.String, *node.Array: return true
+
+	default: return false
+	}
+}
+
+func (p *Parser) parseArray(start token.Token) *node.Array {
+	n := &node.Array{Token: start}
+	p.next()
+
+	n.Type = p.parseType()
+	for p.tok.Type != token.RParen && p.tok.Type != token.EOF {
+		val := p.parseExpr()
+		if p.tok.Type == token.Dots {
+			fill := &node.Fill{Token: p.tok}
+			p.next()
+
+			fill.Value = val
+			fill.Count = p.parseExpr()
+
+			n.Values = append(n.Values, fill)
+		} else {
+			n.Values = append(n.Values, val)
+		}
+	}
+
+	if p.tok.Type != token.RParen {
+		goerror.Error(p.tok.Where, "Expected matching '%v', got %v", token.RParen, p.tok)
+		goerror.Note(start.Where, "Opened here")
+		return nil
+	}
+	p.next()
+
+	return n
+}
+
+func (p *Parser) parseAt(start token.Token) *node.At {
+	n := &node.At{Token: start}
+	p.next()
+
+	n.Id    = p.parseId()
+	n.Index = p.parseExpr()
+
+	if p.tok.Type != token.RParen {
+		goerror.Error(p.tok.Where, "Expected matching '%v', got %v", token.RParen, p.tok)
+		goerror.Note(start.Where, "Opened here")
+		return nil
+	}
+	p.next()
+
+	return n
+}
+
+func (p *Parser) parseOffsetOf(start token.Token) *node.OffsetOf {
+	n := &node.OffsetOf{Token: start}
+	p.next()
+
+	n.Struct = p.parseId()
+	n.Member = p.parseId()
+
+	if p.tok.Type != token.RParen {
+		goerror.Error(p.tok.Where, "Expected matching '%v', got %v", token.RParen, p.tok)
+		goerror.Note(start.Where, "Opened here")
+		return nil
+	}
+	p.next()
+
+	return n
+}
+
+func (p *Parser) parseField(start token.Token) *node.Field {
+	n := &node.Field{Token: start}
+	p.next()
+
+	n.Id     = p.parseId()
+	n.Member = p.parseId()
+
+	if p.tok.Type != token.RParen {
+		goerror.Error(p.tok.Where, "Expected matching '%v', got %v", token.RParen, p.tok)
+		goerror.Note(start.Where, "Opened here")
+		return nil
+	}
+	p.next()
+
+	return n
+}
+
+func (p *Parser) parseCast(start token.Token) *node.Cast {
+	n := &node.Cast{Token: start}
+
+	n.Type  = p.parseType()
+	n.Value = p.parseExpr()
+
+	if p.tok.Type != token.RParen {
+		goerror.Error(p.tok.Where, "Expected matching '%v', got %v", token.RParen, p.tok)
+		goerror.Note(start.Where, "Opened here")
+		return nil
+	}
+	p.next()
+
 	return n
 }
 
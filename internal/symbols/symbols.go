@@ -0,0 +1,196 @@
+package symbols
+
+import (
+	"os"
+	"fmt"
+	"bufio"
+	"strings"
+	"strconv"
+
+	"github.com/avm-collection/agen"
+)
+
+// Symbol maps are text files with a symbol per line:
+//   label NAME ADDR
+//   var   NAME ADDR SIZE TYPE [ro] [alias:VAR]
+//   enum  NAME MEMBER VALUE
+
+type Kind int
+const (
+	Label = Kind(iota)
+	Var
+	Enum
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Label: return "label"
+	case Var:   return "var"
+	case Enum:  return "enum"
+
+	default: panic("Unreachable")
+	}
+}
+
+type Symbol struct {
+	Kind Kind
+	Name string
+
+	Value agen.Word // Address of labels and vars, value of enum members
+	Size  agen.Word
+	Type  string
+
+	ReadOnly bool   // Memory of the var must not be written into
+	Alias    string // Var whose memory this var shares
+
+	Member string
+}
+
+func (s Symbol) String() string {
+	switch s.Kind {
+	case Label: return fmt.Sprintf("%v %v %v", s.Kind, s.Name, s.Value)
+	case Var:
+		str := fmt.Sprintf("%v %v %v %v %v", s.Kind, s.Name, s.Value, s.Size, s.Type)
+		if s.ReadOnly {
+			str += " ro"
+		}
+
+		if len(s.Alias) > 0 {
+			str += " alias:" + s.Alias
+		}
+
+		return str
+
+	case Enum: return fmt.Sprintf("%v %v %v %v", s.Kind, s.Name, s.Member, s.Value)
+
+	default: panic("Unreachable")
+	}
+}
+
+type Map struct {
+	List []Symbol
+}
+
+func (m *Map) Add(s Symbol) {
+	m.List = append(m.List, s)
+}
+
+func (m *Map) LabelsAt(addr agen.Word) (names []string) {
+	for _, s := range m.List {
+		if s.Kind == Label && s.Value == addr {
+			names = append(names, s.Name)
+		}
+	}
+
+	return
+}
+
+func (m *Map) EnumsWith(value agen.Word) (names []string) {
+	for _, s := range m.List {
+		if s.Kind == Enum && s.Value == value {
+			names = append(names, s.Member)
+		}
+	}
+
+	return
+}
+
+func (m *Map) Write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, s := range m.List {
+		if _, err := fmt.Fprintln(f, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func Read(path string) (*Map, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &Map{}
+	scanner := bufio.NewScanner(f)
+	for row := 1; scanner.Scan(); row ++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		s, err := parse(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", path, row, err.Error())
+		}
+
+		m.Add(s)
+	}
+
+	return m, scanner.Err()
+}
+
+func parse(fields []string) (s Symbol, err error) {
+	var (
+		args  int
+		value string
+	)
+	switch fields[0] {
+	case "label": s.Kind, args = Label, 3
+	case "var":   s.Kind, args = Var,   5
+	case "enum":  s.Kind, args = Enum,  4
+
+	default: return s, fmt.Errorf("Unknown symbol kind '%v'", fields[0])
+	}
+
+	// Vars have optional flags
+	for s.Kind == Var && len(fields) > args {
+		flag := fields[len(fields) - 1]
+		if flag == "ro" {
+			s.ReadOnly = true
+		} else if strings.HasPrefix(flag, "alias:") {
+			s.Alias = strings.TrimPrefix(flag, "alias:")
+		} else {
+			return s, fmt.Errorf("Unknown var flag '%v'", flag)
+		}
+
+		fields = fields[:len(fields) - 1]
+	}
+
+	if len(fields) != args {
+		return s, fmt.Errorf("Expected %v fields for a %v, got %v", args, s.Kind, len(fields))
+	}
+
+	s.Name = fields[1]
+	switch s.Kind {
+	case Label: value = fields[2]
+	case Var:
+		value  = fields[2]
+		s.Type = fields[4]
+
+		size, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return s, fmt.Errorf("Invalid size '%v'", fields[3])
+		}
+		s.Size = agen.Word(size)
+
+	case Enum:
+		s.Member = fields[2]
+		value    = fields[3]
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return s, fmt.Errorf("Invalid value '%v'", value)
+	}
+	s.Value = agen.Word(parsed)
+
+	return s, nil
+}
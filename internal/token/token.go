@@ -33,14 +33,36 @@ const (
 	String
 
 	Let
+	Const
 	Macro
 	Equals
 
+	Struct
+	Align
+	Org
+	End
+
+	Enum
+	Flags
+
+	If
+	Else
+	While
+	Do
+	Loop
+	Break
+	Table
+	Switch
+	Proc
+	EndProc
+	Dashes
+
 	TypeByte
 	TypeChar
 	TypeInt16
 	TypeInt32
 	TypeInt64
+	TypeFloat32
 	TypeFloat64
 
 	Add
@@ -55,7 +77,22 @@ const (
 	BitSRight
 	BitSLeft
 
+	Eq
+	NotEq
+	Greater
+	GreaterEq
+	Less
+	LessEq
+
 	SizeOf
+	CountOf
+	ElemSize
+	TypeOf
+	At
+	OffsetOf
+	Field
+	Here
+	Cursor
 
 	Dots
 
@@ -64,6 +101,11 @@ const (
 
 	Include
 	Embed
+	Reserve
+
+	Assert
+	UserError
+	UserWarning
 
 	Error
 	count // Count of all token types
@@ -71,7 +113,7 @@ const (
 
 // TODO: Somehow make this compile-time
 func AllTokensCoveredTest() {
-	if count != 37 {
+	if count != 74 {
 		panic("Cover all token types")
 	}
 }
@@ -93,14 +135,38 @@ func (t Type) String() string {
 	case String: return "string"
 
 	case Let:    return "let"
+	case Const:  return "const"
 	case Macro:  return "mac"
 	case Equals: return "="
 
+	case Struct: return "struct"
+	case Align:  return "align"
+	case Org:    return "org"
+	case End:    return "end"
+
+	case Enum:  return "enum"
+	case Flags: return "flags"
+
+	case If:    return "if"
+	case Else:  return "else"
+	case While: return "while"
+	case Do:    return "do"
+	case Loop:  return "loop"
+	case Break: return "break"
+
+	case Table:  return "table"
+	case Switch: return "switch"
+
+	case Proc:    return "proc"
+	case EndProc: return "endp"
+	case Dashes:  return "--"
+
 	case TypeByte:    return "byte"
 	case TypeChar:    return "char"
 	case TypeInt16:   return "int16"
 	case TypeInt32:   return "int32"
 	case TypeInt64:   return "int64"
+	case TypeFloat32: return "float32"
 	case TypeFloat64: return "float64"
 
 	case Add:  return "+"
@@ -115,7 +181,22 @@ func (t Type) String() string {
 	case BitSRight: return ">>"
 	case BitSLeft:  return "<<"
 
-	case SizeOf: return "sizeof"
+	case Eq:        return "=="
+	case NotEq:     return "!="
+	case Greater:   return ">"
+	case GreaterEq: return ">="
+	case Less:      return "<"
+	case LessEq:    return "<="
+
+	case SizeOf:   return "sizeof"
+	case CountOf:  return "countof"
+	case ElemSize: return "elemsize"
+	case TypeOf:   return "typeof"
+	case At:       return "at"
+	case OffsetOf: return "offsetof"
+	case Field:    return "field"
+	case Here:     return "$"
+	case Cursor:   return "$$"
 
 	case Dots: return ".."
 
@@ -124,6 +205,11 @@ func (t Type) String() string {
 
 	case Include: return "include"
 	case Embed:   return "embed"
+	case Reserve: return "res"
+
+	case Assert:      return "assert"
+	case UserError:   return "error"
+	case UserWarning: return "warning"
 
 	case Error: return "error"
 
@@ -141,7 +227,8 @@ func (type_ Type) IsInt() bool {
 
 func (type_ Type) IsType() bool {
 	switch type_ {
-	case TypeByte, TypeChar, TypeInt16, TypeInt32, TypeInt64, TypeFloat64: return true
+	case TypeByte, TypeChar, TypeInt16, TypeInt32, TypeInt64,
+	     TypeFloat32, TypeFloat64: return true
 
 	default: return false
 	}
@@ -149,7 +236,30 @@ func (type_ Type) IsType() bool {
 
 func (type_ Type) IsBinOp() bool {
 	switch type_ {
-	case Add, Sub, Mult, Div, Mod, Pow: return true
+	case Add, Sub, Mult, Div, Mod, Pow,
+	     BitAnd, BitOr, BitSRight, BitSLeft,
+	     Eq, NotEq, Greater, GreaterEq, Less, LessEq: return true
+
+	default: return false
+	}
+}
+
+// Keywords are only special where a statement or a function starts, elsewhere they are names
+func (type_ Type) IsKeyword() bool {
+	switch type_ {
+	case Let, Const, Macro, Embed, Reserve, Include,
+	     Struct, Align, Org, End, Enum, Flags,
+	     If, Else, While, Do, Loop, Break, Table, Switch, Proc, EndProc,
+	     Assert, UserError, UserWarning,
+	     SizeOf, CountOf, ElemSize, TypeOf, At, OffsetOf, Field: return true
+
+	default: return false
+	}
+}
+
+func (type_ Type) IsQuery() bool {
+	switch type_ {
+	case SizeOf, CountOf, ElemSize, TypeOf: return true
 
 	default: return false
 	}